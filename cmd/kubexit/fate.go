@@ -0,0 +1,125 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/karlkfi/kubexit/pkg/tombstone"
+)
+
+// fate records the first non-zero death of another member of a fate group.
+// A nil fate never fails, so that processes without a fate group can use
+// it without checks.
+type fate struct {
+	lock   sync.Mutex
+	failed bool
+	origin string
+	code   int
+}
+
+// fail records the failure of the originating member, and returns false if
+// a failure was already recorded.
+func (f *fate) fail(origin string, code int) bool {
+	if f == nil {
+		return false
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.failed {
+		return false
+	}
+	f.failed = true
+	f.origin = origin
+	f.code = code
+	return true
+}
+
+// failure returns the originating member and its exit code, if failed.
+func (f *fate) failure() (string, int, bool) {
+	if f == nil {
+		return "", 0, false
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.origin, f.code, f.failed
+}
+
+// recordDeath records the death of the process in its tombstone. If another
+// member of the fate group failed, its name and exit code are recorded
+// instead of the child exit code. Returns the recorded exit code.
+func (f *fate) recordDeath(ts *tombstone.Tombstone, code int) (int, error) {
+	if origin, originCode, failed := f.failure(); failed {
+		log.Printf("Propagating exit code from fate group member %s: %d\n", origin, originCode)
+		ts.FailedBy = origin
+		code = originCode
+	}
+	return code, ts.RecordDeath(code)
+}
+
+// onFateGroupFailure returns an EventHandler that executes the callback when
+// any other member of the fate group dies with a non-zero exit code.
+// Tombstones of members that were terminated by another member name the
+// originating member in FailedBy, so the callback receives the originating
+// member name.
+func onFateGroupFailure(self, group string, callback func(origin string, code int)) tombstone.EventHandler {
+	return func(event fsnotify.Event) {
+		if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+			// ignore other events
+			return
+		}
+		name := filepath.Base(event.Name)
+		if name == self || strings.HasPrefix(name, ".") {
+			// ignore own and temporary tombstones
+			return
+		}
+
+		ts, err := tombstone.Read(filepath.Dir(event.Name), name)
+		if err != nil {
+			log.Printf("Error: failed to read tombstone: %v\n", err)
+			return
+		}
+		if origin, code, failed := fateGroupFailure(ts, group); failed {
+			callback(origin, code)
+		}
+	}
+}
+
+// checkFateGroupFailed executes the callback if any other member of the fate
+// group in the graveyard already died with a non-zero exit code, because
+// members that failed before the graveyard was watched are not seen by
+// onFateGroupFailure.
+func checkFateGroupFailed(graveyard, self, group string, callback func(origin string, code int)) {
+	tombstones, err := tombstone.ReadAll(graveyard)
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		return
+	}
+	for _, ts := range tombstones {
+		if ts.Name == self {
+			continue
+		}
+		if origin, code, failed := fateGroupFailure(ts, group); failed {
+			callback(origin, code)
+			return
+		}
+	}
+}
+
+// fateGroupFailure returns the originating member and exit code, if the
+// tombstone is of a member of the fate group that died with a non-zero exit
+// code.
+func fateGroupFailure(ts *tombstone.Tombstone, group string) (string, int, bool) {
+	if ts.FateGroup != group || ts.Died == nil || exitCodeOf(ts) == 0 {
+		return "", 0, false
+	}
+
+	origin := ts.Name
+	if ts.FailedBy != "" {
+		origin = ts.FailedBy
+	}
+	log.Printf("Fate group %s member %s failed: %s exited(%d)\n", group, origin, ts.Name, exitCodeOf(ts))
+	return origin, exitCodeOf(ts), true
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// version is set at build time with -ldflags "-X main.version=<version>"
+var version = "dev"
+
+// settings are the config values that can be set by flag or env var.
+// Each flag name is derived from the env var name: KUBEXIT_BIRTH_DEPS is
+// --birth-deps.
+var settings = []struct {
+	env   string
+	usage string
+}{
+	{"KUBEXIT_NAME", "Name of the tombstone file. Must match the container name, if using birth deps."},
+	{"KUBEXIT_GRAVEYARD", "Path of the graveyard directory. (default /graveyard)"},
+	{"KUBEXIT_TOPOLOGY", "Path of a pod-wide topology YAML file."},
+	{"KUBEXIT_PROCESSES", "Path of a Procfile or YAML file of processes to supervise, instead of a command."},
+	{"KUBEXIT_PRIMARY", "Name of the process whose exit ends the container, with --processes. (default: primary in the file)"},
+	{"KUBEXIT_ANNOTATIONS_PATH", "Path of a Downward API pod annotations file."},
+	{"KUBEXIT_BIRTH_DEPS", "Birth deps, comma separated."},
+	{"KUBEXIT_BIRTH_TIMEOUT", "Duration to wait for birth deps to be ready. (default 30s)"},
+	{"KUBEXIT_BIRTH_STABILITY", "Duration birth deps must stay ready before starting. (default 0s)"},
+	{"KUBEXIT_DEATH_DEPS", "Death deps, comma separated."},
+	{"KUBEXIT_GRACE_PERIOD", "Duration to wait after TERM before KILL. (default 30s)"},
+	{"KUBEXIT_RESTART_POLICY", "Restart the command in-process: never, on-failure, or always. (default never)"},
+	{"KUBEXIT_MAX_RESTARTS", "Maximum number of restarts. (default 0, unlimited)"},
+	{"KUBEXIT_RESTART_BACKOFF", "Delay before the first restart, doubled for each restart. (default 1s)"},
+	{"KUBEXIT_MAX_RESTART_BACKOFF", "Maximum delay between restarts. (default 5m)"},
+	{"KUBEXIT_FATE_GROUP", "Name of a group of processes that fail together on any non-zero exit."},
+	{"KUBEXIT_ROLE", "Role of the process: primary or sidecar. Sidecars exit once every primary has died."},
+	{"KUBEXIT_PRIMARIES", "Minimum number of primaries that must die before a sidecar exits. (default: primaries in the topology, or 1)"},
+	{"KUBEXIT_POD_NAME", "Name of the pod. (default: discovered)"},
+	{"KUBEXIT_NAMESPACE", "Namespace of the pod. (default: discovered)"},
+	{"KUBEXIT_KUBE_CONTEXT", "Kubeconfig context. Forces use of kubeconfig."},
+	{"KUBEXIT_KUBE_QPS", "Kubernetes API client max queries per second."},
+	{"KUBEXIT_KUBE_BURST", "Kubernetes API client max burst."},
+	{"KUBEXIT_EVENTS", "Record Kubernetes Events for lifecycle transitions. (default false)"},
+	{"KUBEXIT_TOMBSTONE_ANNOTATION", "Mirror the tombstone into a pod annotation. (default false)"},
+	{"KUBEXIT_READINESS_GATE", "Pod condition type to manage as a readiness gate."},
+	{"KUBEXIT_TERMINATION_MESSAGE_PATH", "Path of the termination message file. (default /dev/termination-log)"},
+	{"KUBEXIT_TERMINATION_MESSAGE_LINES", "Lines of output to include in the termination message. (default 0)"},
+}
+
+// subcommands run instead of supervising a child command, by name.
+// Each returns the exit code.
+var subcommands = map[string]func(args []string) int{
+	"inject":  runInject,
+	"graph":   runGraph,
+	"lint":    runLint,
+	"webhook": runWebhook,
+}
+
+// lookupSubcommand returns the subcommand named by the first argument, if
+// any. Executables in the PATH take precedence over subcommands with the same
+// name, so that existing `kubexit <command>` invocations keep supervising
+// the command.
+func lookupSubcommand(args []string) (func(args []string) int, bool) {
+	if len(args) == 0 {
+		return nil, false
+	}
+	subcommand, ok := subcommands[args[0]]
+	if !ok {
+		return nil, false
+	}
+	if _, err := exec.LookPath(args[0]); err == nil {
+		return nil, false
+	}
+	return subcommand, true
+}
+
+// flagValues are the values of flags that were explicitly set, by env var name.
+var flagValues = map[string]string{}
+
+// flagName returns the flag name for an env var name.
+func flagName(env string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(env, "KUBEXIT_")), "_", "-")
+}
+
+// getenv returns the value of the flag for an env var, if set, otherwise the
+// value of the env var.
+func getenv(env string) string {
+	if value, ok := flagValues[env]; ok {
+		return value
+	}
+	return os.Getenv(env)
+}
+
+// options are flags that control kubexit itself, rather than configure it.
+type options struct {
+	printConfig bool
+}
+
+// parseFlags parses the flags before the child command, which starts at the
+// first non-flag argument or after `--`. Flags are optional, so that
+// env-only invocation (`kubexit <command> [args...]`) still works.
+// Exits after printing help or version.
+func parseFlags(args []string) (options, []string) {
+	var opts options
+	fs := flag.NewFlagSet("kubexit", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	values := map[string]*string{}
+	for _, setting := range settings {
+		values[setting.env] = fs.String(flagName(setting.env), "", fmt.Sprintf("%s [%s]", setting.usage, setting.env))
+	}
+	showVersion := fs.Bool("version", false, "Print the version and exit.")
+	fs.BoolVar(&opts.printConfig, "print-config", false, "Print the effective configuration, as env vars, and exit.")
+
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		fs.SetOutput(os.Stdout)
+		printUsage(fs)
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fs.SetOutput(os.Stderr)
+		printUsage(fs)
+		os.Exit(2)
+	}
+
+	if *showVersion {
+		fmt.Println(version)
+		os.Exit(0)
+	}
+
+	// only explicitly set flags override env vars
+	fs.Visit(func(f *flag.Flag) {
+		for env, value := range values {
+			if flagName(env) == f.Name {
+				flagValues[env] = *value
+			}
+		}
+	})
+
+	return opts, fs.Args()
+}
+
+// printSettings prints the effective config values, by env var name, as
+// `KUBEXIT_<NAME>=<value>` lines in the order of the settings, so that the
+// output can be used as an env file. Empty values are omitted.
+func printSettings(w io.Writer, values map[string]string) {
+	for _, setting := range settings {
+		if value := values[setting.env]; value != "" {
+			fmt.Fprintf(w, "%s=%s\n", setting.env, value)
+		}
+	}
+}
+
+func printUsage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintln(out, "Usage: kubexit [flags] [--] <command> [args...]")
+	fmt.Fprintln(out, "       kubexit [flags] --processes <file>")
+	fmt.Fprintln(out, "       kubexit <subcommand> [flags] [args...]")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Command supervisor for coordinated Kubernetes pod container termination.")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Subcommands:")
+	fmt.Fprintln(out, "  inject    Inject kubexit into pod manifests.")
+	fmt.Fprintln(out, "  lint      Report mistakes in the kubexit configuration of pod manifests.")
+	fmt.Fprintln(out, "  graph     Print the dependency graph of pod manifests or a graveyard.")
+	fmt.Fprintln(out, "  webhook   Serve a mutating admission webhook that injects kubexit.")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Executables in the PATH take precedence over subcommands with the same name.")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Every flag defaults to the env var in brackets.")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Flags:")
+	fs.PrintDefaults()
+}
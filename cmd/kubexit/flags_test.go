@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupSubcommand(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+
+	if _, ok := lookupSubcommand([]string{"lint", "pod.yaml"}); !ok {
+		t.Error("expected lint subcommand")
+	}
+	if _, ok := lookupSubcommand([]string{"sleep", "1"}); ok {
+		t.Error("expected no subcommand for sleep")
+	}
+	if _, ok := lookupSubcommand(nil); ok {
+		t.Error("expected no subcommand without args")
+	}
+
+	// an executable with the same name takes precedence
+	err := os.WriteFile(filepath.Join(dir, "lint"), []byte("#!/bin/sh\n"), 0755)
+	if err != nil {
+		t.Fatalf("failed to write executable: %v", err)
+	}
+	if _, ok := lookupSubcommand([]string{"lint", "pod.yaml"}); ok {
+		t.Error("expected lint executable to take precedence")
+	}
+}
+
+func TestPrintSettings(t *testing.T) {
+	var out bytes.Buffer
+	printSettings(&out, map[string]string{
+		"KUBEXIT_GRACE_PERIOD": "30s",
+		"KUBEXIT_NAME":         "app",
+		"KUBEXIT_ROLE":         "",
+	})
+	expected := "KUBEXIT_NAME=app\nKUBEXIT_GRACE_PERIOD=30s\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/karlkfi/kubexit/pkg/graph"
+	"github.com/karlkfi/kubexit/pkg/inject"
+	"github.com/karlkfi/kubexit/pkg/tombstone"
+	"github.com/karlkfi/kubexit/pkg/topology"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// runGraph implements `kubexit graph`, which prints the dependency graph of
+// the pods in manifests, of a topology file, or of a live graveyard.
+func runGraph(args []string) int {
+	fs := flag.NewFlagSet("kubexit graph", flag.ContinueOnError)
+	format := fs.String("format", "dot", "Output format: dot or mermaid.")
+	graveyard := fs.String("graveyard", "", "Path of a graveyard directory to read the process state from.")
+	topologyPath := fs.String("topology", "", "Path of a topology YAML file to read the dependencies from.")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: kubexit graph [flags] [file...]")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Prints the birth and death dependency graph of the pods in manifest files,")
+		fmt.Fprintln(out, "of a topology file, or of the tombstones in a graveyard.")
+		fmt.Fprintln(out, "With --graveyard, processes are annotated with their state and exit code.")
+		fmt.Fprintln(out, "A graveyard belongs to a single pod, so manifest files must then contain")
+		fmt.Fprintln(out, "exactly one pod or pod template.")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Flags:")
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+	if *format != "dot" && *format != "mermaid" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format: %s\n", *format)
+		return 2
+	}
+	if fs.NArg() == 0 && *topologyPath == "" && *graveyard == "" {
+		fmt.Fprintln(os.Stderr, "Error: no manifest files, --topology, or --graveyard found")
+		fs.Usage()
+		return 2
+	}
+
+	var tombstones []*tombstone.Tombstone
+	if *graveyard != "" {
+		tombstones, err = tombstone.ReadAll(*graveyard)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+
+	var graphs []*graph.Graph
+	switch {
+	case fs.NArg() > 0:
+		var names []string
+		for _, path := range fs.Args() {
+			topologies, err := readManifestTopologies(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			for _, named := range topologies {
+				names = append(names, named.name)
+				graphs = append(graphs, graph.New(named.name, named.topology))
+			}
+		}
+		if *graveyard != "" && len(graphs) > 1 {
+			// the graveyard state would be applied to every pod
+			fmt.Fprintf(os.Stderr, "Error: --graveyard requires exactly one pod or pod template, found %d: %s\n",
+				len(graphs), strings.Join(names, ", "))
+			return 2
+		}
+	case *topologyPath != "":
+		topo, err := topology.Read(*topologyPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		graphs = append(graphs, graph.New(*topologyPath, topo))
+	default:
+		graphs = append(graphs, graph.FromTombstones(*graveyard, tombstones))
+	}
+
+	for i, g := range graphs {
+		if *graveyard != "" {
+			g.SetState(tombstones)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		if *format == "mermaid" {
+			fmt.Print(g.Mermaid())
+		} else {
+			fmt.Print(g.DOT())
+		}
+	}
+	return 0
+}
+
+// namedTopology is the topology of the pod template of an object.
+type namedTopology struct {
+	name     string
+	topology *topology.Topology
+}
+
+// readManifestTopologies reads the topology of each pod and pod template in
+// a multi-document YAML file, named by the kind and name of the object.
+// Objects without kubexit processes are skipped.
+func readManifestTopologies(path string) ([]namedTopology, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %v", err)
+	}
+	defer file.Close()
+
+	var topologies []namedTopology
+	err = inject.WalkObjects(file, func(_ []byte, obj *unstructured.Unstructured) error {
+		templatePath, ok := inject.PodTemplatePath(obj.GetKind())
+		if !ok {
+			return nil
+		}
+
+		name := fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName())
+		annotations, spec, err := inject.PodTemplate(obj, templatePath)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		topo, err := topology.FromPodSpec(*spec, annotations)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if len(topo.Processes) > 0 {
+			topologies = append(topologies, namedTopology{name: name, topology: topo})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return topologies, nil
+}
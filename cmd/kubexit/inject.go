@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/karlkfi/kubexit/pkg/inject"
+	"github.com/karlkfi/kubexit/pkg/podinfo"
+)
+
+// depsFlag is a repeatable flag of the form `<container>=<deps>`.
+type depsFlag map[string]string
+
+func (f depsFlag) String() string {
+	var values []string
+	for name, deps := range f {
+		values = append(values, fmt.Sprintf("%s=%s", name, deps))
+	}
+	sort.Strings(values)
+	return strings.Join(values, " ")
+}
+
+func (f depsFlag) Set(value string) error {
+	name, deps, found := strings.Cut(value, "=")
+	if !found || name == "" {
+		return fmt.Errorf("expected <container>=<deps>: %q", value)
+	}
+	f[name] = deps
+	return nil
+}
+
+// runInject implements `kubexit inject`, which reads manifests from files (or
+// stdin) and writes them to stdout with kubexit injected.
+func runInject(args []string) int {
+	fs := flag.NewFlagSet("kubexit inject", flag.ContinueOnError)
+	image := fs.String("image", inject.DefaultImage, "Image to copy the kubexit binary from.")
+	graveyard := fs.String("graveyard", inject.DefaultGraveyard, "Mount path of the graveyard volume.")
+	binDir := fs.String("bin-dir", inject.DefaultBinDir, "Mount path of the volume the kubexit binary is copied into.")
+	birthDeps := depsFlag{}
+	fs.Var(birthDeps, "birth-deps", "Birth deps of a container, as <container>=<deps>. Repeatable.")
+	deathDeps := depsFlag{}
+	fs.Var(deathDeps, "death-deps", "Death deps of a container, as <container>=<deps>. Repeatable.")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: kubexit inject [flags] [file...]")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Injects kubexit into Pod, Deployment, StatefulSet, DaemonSet, ReplicaSet, Job,")
+		fmt.Fprintln(out, "and CronJob manifests, and writes them to stdout. Reads stdin if no files are given.")
+		fmt.Fprintln(out, "Deps are also read from kubexit.io/deps.<container> pod template annotations.")
+		fmt.Fprintln(out, "Containers with deps, or that are death deps, must set command, because")
+		fmt.Fprintln(out, "kubexit is prepended to it and the image entrypoint is not known.")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Flags:")
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+
+	cfg := inject.Config{
+		Image:     *image,
+		Graveyard: *graveyard,
+		BinDir:    *binDir,
+		Deps:      map[string]podinfo.Deps{},
+	}
+	for name, deps := range birthDeps {
+		containerDeps := cfg.Deps[name]
+		containerDeps.Birth = deps
+		cfg.Deps[name] = containerDeps
+	}
+	for name, deps := range deathDeps {
+		containerDeps := cfg.Deps[name]
+		containerDeps.Death = deps
+		cfg.Deps[name] = containerDeps
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	for i, path := range paths {
+		if i > 0 {
+			fmt.Fprintln(os.Stdout, "---")
+		}
+		err = injectFile(path, os.Stdout, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+func injectFile(path string, w io.Writer, cfg inject.Config) error {
+	if path == "-" {
+		return inject.Manifests(os.Stdin, w, cfg)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open manifest: %v", err)
+	}
+	defer file.Close()
+	err = inject.Manifests(file, w, cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
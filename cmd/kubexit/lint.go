@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/karlkfi/kubexit/pkg/lint"
+)
+
+// runLint implements `kubexit lint`, which statically analyses manifests
+// from files (or stdin) and reports mistakes in the kubexit configuration.
+// Exits 1 if any problems are found, for use in CI.
+func runLint(args []string) int {
+	fs := flag.NewFlagSet("kubexit lint", flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: kubexit lint [file...]")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Reports mistakes in the kubexit configuration of Pod, Deployment, StatefulSet,")
+		fmt.Fprintln(out, "DaemonSet, ReplicaSet, Job, and CronJob manifests, with file and line positions.")
+		fmt.Fprintln(out, "Reads stdin if no files are given. Exits 1 if any problems are found.")
+	}
+
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	var count int
+	for _, path := range paths {
+		findings, err := lintFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		for _, finding := range findings {
+			fmt.Println(finding)
+		}
+		count += len(findings)
+	}
+	if count > 0 {
+		fmt.Fprintf(os.Stderr, "Found %d problem(s)\n", count)
+		return 1
+	}
+	return 0
+}
+
+func lintFile(path string) ([]lint.Finding, error) {
+	var r io.Reader = os.Stdin
+	name := "<stdin>"
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open manifest: %v", err)
+		}
+		defer file.Close()
+		r = file
+		name = path
+	}
+	return lint.Lint(name, r)
+}
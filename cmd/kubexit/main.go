@@ -5,19 +5,28 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/karlkfi/kubexit/pkg/birth"
 	"github.com/karlkfi/kubexit/pkg/kubernetes"
+	"github.com/karlkfi/kubexit/pkg/podinfo"
 	"github.com/karlkfi/kubexit/pkg/supervisor"
+	"github.com/karlkfi/kubexit/pkg/termination"
 	"github.com/karlkfi/kubexit/pkg/tombstone"
+	"github.com/karlkfi/kubexit/pkg/topology"
 
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
@@ -27,26 +36,36 @@ func main() {
 	// remove log timestamp
 	log.SetFlags(log.Flags() &^ (log.Ldate | log.Ltime))
 
-	args := os.Args[1:]
-	if len(args) == 0 {
+	// child commands take precedence over subcommands with the same name
+	if subcommand, ok := lookupSubcommand(os.Args[1:]); ok {
+		os.Exit(subcommand(os.Args[2:]))
+	}
+
+	opts, args := parseFlags(os.Args[1:])
+
+	// a processes file replaces the child command and the single tombstone
+	processesPath := getenv("KUBEXIT_PROCESSES")
+	if processesPath != "" {
+		if len(args) > 0 {
+			log.Printf("Error: unexpected command with processes file: %s\n", strings.Join(args, " "))
+			os.Exit(2)
+		}
+		os.Exit(runProcesses(processesPath, graveyardPath(), opts.printConfig))
+	}
+
+	if len(args) == 0 && !opts.printConfig {
 		log.Println("Error: no arguments found")
 		os.Exit(2)
 	}
 
-	name := os.Getenv("KUBEXIT_NAME")
+	name := getenv("KUBEXIT_NAME")
 	if name == "" {
-		log.Println("Error: missing env var: KUBEXIT_NAME")
+		log.Println("Error: missing flag or env var: --name or KUBEXIT_NAME")
 		os.Exit(2)
 	}
 	log.Printf("Name: %s\n", name)
 
-	graveyard := os.Getenv("KUBEXIT_GRAVEYARD")
-	if graveyard == "" {
-		graveyard = "/graveyard"
-	} else {
-		graveyard = strings.TrimRight(graveyard, "/")
-		graveyard = filepath.Clean(graveyard)
-	}
+	graveyard := graveyardPath()
 	log.Printf("Graveyard: %s\n", graveyard)
 
 	ts := &tombstone.Tombstone{
@@ -55,16 +74,69 @@ func main() {
 	}
 	log.Printf("Tombstone: %s\n", ts.Path())
 
-	birthDepsStr := os.Getenv("KUBEXIT_BIRTH_DEPS")
-	var birthDeps []string
+	topologyPath := getenv("KUBEXIT_TOPOLOGY")
+	var proc topology.Process
+	var topologyPrimaries int
+	if topologyPath == "" {
+		log.Println("Topology: N/A")
+	} else {
+		log.Printf("Topology: %s\n", topologyPath)
+		topo, err := topology.Read(topologyPath)
+		if err != nil {
+			log.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+		// validate the whole graph, not just this process
+		err = topo.Validate()
+		if err != nil {
+			log.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+		proc, err = topo.Process(name)
+		if err != nil {
+			log.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+		topologyPrimaries = topo.Primaries()
+	}
+
+	annotationsPath := getenv("KUBEXIT_ANNOTATIONS_PATH")
+	var annotations map[string]string
+	var annotationDeps podinfo.Deps
+	if annotationsPath == "" {
+		log.Println("Annotations Path: N/A")
+	} else {
+		log.Printf("Annotations Path: %s\n", annotationsPath)
+		annotations, err = podinfo.ReadAnnotations(annotationsPath)
+		if err != nil {
+			log.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+		if value, ok := annotations[podinfo.DepsAnnotationPrefix+name]; ok {
+			annotationDeps, err = podinfo.ParseDeps(value)
+			if err != nil {
+				log.Printf("Error: %v\n", err)
+				os.Exit(2)
+			}
+		}
+	}
+
+	// flags and env vars take precedence over annotations, which take
+	// precedence over the topology
+	birthDepsStr := firstNonEmpty(getenv("KUBEXIT_BIRTH_DEPS"), annotationDeps.Birth, strings.Join(proc.BirthDeps, ","))
+	var birthDeps []birth.Dependency
 	if birthDepsStr == "" {
 		log.Println("Birth Deps: N/A")
 	} else {
-		birthDeps = strings.Split(birthDepsStr, ",")
-		log.Printf("Birth Deps: %s\n", strings.Join(birthDeps, ","))
+		birthDeps, err = birth.ParseDependencies(birthDepsStr)
+		if err != nil {
+			log.Printf("Error: failed to parse birth deps: %v\n", err)
+			os.Exit(2)
+		}
+		log.Printf("Birth Deps: %s\n", joinDeps(birthDeps))
 	}
 
-	deathDepsStr := os.Getenv("KUBEXIT_DEATH_DEPS")
+	deathDepsStr := firstNonEmpty(getenv("KUBEXIT_DEATH_DEPS"), annotationDeps.Death, strings.Join(proc.DeathDeps, ","))
 	var deathDeps []string
 	if deathDepsStr == "" {
 		log.Println("Death Deps: N/A")
@@ -74,7 +146,7 @@ func main() {
 	}
 
 	birthTimeout := 30 * time.Second
-	birthTimeoutStr := os.Getenv("KUBEXIT_BIRTH_TIMEOUT")
+	birthTimeoutStr := firstNonEmpty(getenv("KUBEXIT_BIRTH_TIMEOUT"), proc.BirthTimeout)
 	if birthTimeoutStr != "" {
 		birthTimeout, err = time.ParseDuration(birthTimeoutStr)
 		if err != nil {
@@ -84,8 +156,23 @@ func main() {
 	}
 	log.Printf("Birth Timeout: %s\n", birthTimeout)
 
+	var birthStability time.Duration
+	birthStabilityStr := firstNonEmpty(getenv("KUBEXIT_BIRTH_STABILITY"), proc.BirthStability)
+	if birthStabilityStr != "" {
+		birthStability, err = time.ParseDuration(birthStabilityStr)
+		if err != nil {
+			log.Printf("Error: failed to parse birth stability: %v\n", err)
+			os.Exit(2)
+		}
+		if birthStability < 0 {
+			log.Printf("Error: invalid birth stability: %s: must not be negative\n", birthStability)
+			os.Exit(2)
+		}
+	}
+	log.Printf("Birth Stability: %s\n", birthStability)
+
 	gracePeriod := 30 * time.Second
-	gracePeriodStr := os.Getenv("KUBEXIT_GRACE_PERIOD")
+	gracePeriodStr := firstNonEmpty(getenv("KUBEXIT_GRACE_PERIOD"), proc.GracePeriod)
 	if gracePeriodStr != "" {
 		gracePeriod, err = time.ParseDuration(gracePeriodStr)
 		if err != nil {
@@ -95,29 +182,258 @@ func main() {
 	}
 	log.Printf("Grace Period: %s\n", gracePeriod)
 
-	podName := os.Getenv("KUBEXIT_POD_NAME")
-	if podName == "" {
-		if len(birthDeps) > 0 {
-			log.Println("Error: missing env var: KUBEXIT_POD_NAME")
+	role, err := tombstone.ParseRole(firstNonEmpty(getenv("KUBEXIT_ROLE"), proc.Role))
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	if role == "" {
+		log.Println("Role: N/A")
+	} else {
+		log.Printf("Role: %s\n", role)
+	}
+
+	minPrimaries, err := parsePrimaries(getenv("KUBEXIT_PRIMARIES"), topologyPrimaries)
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	if role == tombstone.RoleSidecar {
+		log.Printf("Primaries: %d (minimum)\n", minPrimaries)
+	}
+
+	fateGroup := firstNonEmpty(getenv("KUBEXIT_FATE_GROUP"), proc.FateGroup)
+	if fateGroup == "" {
+		log.Println("Fate Group: N/A")
+	} else {
+		log.Printf("Fate Group: %s\n", fateGroup)
+	}
+
+	var maxRestarts int
+	maxRestartsStr := getenv("KUBEXIT_MAX_RESTARTS")
+	if maxRestartsStr != "" {
+		maxRestarts, err = strconv.Atoi(maxRestartsStr)
+		if err != nil {
+			log.Printf("Error: failed to parse max restarts: %v\n", err)
 			os.Exit(2)
 		}
-		log.Println("Pod Name: N/A")
+	}
+	restartPolicy, err := newRestartPolicy(getenv("KUBEXIT_RESTART_POLICY"), maxRestarts,
+		getenv("KUBEXIT_RESTART_BACKOFF"), getenv("KUBEXIT_MAX_RESTART_BACKOFF"))
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	log.Printf("Restart Policy: %s\n", formatRestartPolicy(restartPolicy))
+
+	podName := getenv("KUBEXIT_POD_NAME")
+	if podName == "" {
+		if hasContainerDeps(birthDeps) {
+			log.Println("Pod Name: auto-discover")
+		} else {
+			log.Println("Pod Name: N/A")
+		}
 	} else {
 		log.Printf("Pod Name: %s\n", podName)
 	}
 
-	namespace := os.Getenv("KUBEXIT_NAMESPACE")
+	namespace := getenv("KUBEXIT_NAMESPACE")
 	if namespace == "" {
 		if len(birthDeps) > 0 {
-			log.Println("Error: missing env var: KUBEXIT_NAMESPACE")
-			os.Exit(2)
+			log.Println("Namespace: auto-discover")
+		} else {
+			log.Println("Namespace: N/A")
 		}
-		log.Println("Namespace: N/A")
 	} else {
 		log.Printf("Namespace: %s\n", namespace)
 	}
 
+	kubeOpts := kubernetes.ConfigOptions{
+		Context: getenv("KUBEXIT_KUBE_CONTEXT"),
+	}
+	if kubeOpts.Context != "" {
+		log.Printf("Kube Context: %s\n", kubeOpts.Context)
+	}
+
+	kubeQPSStr := getenv("KUBEXIT_KUBE_QPS")
+	if kubeQPSStr != "" {
+		kubeQPS, err := strconv.ParseFloat(kubeQPSStr, 32)
+		if err != nil {
+			log.Printf("Error: failed to parse kube qps: %v\n", err)
+			os.Exit(2)
+		}
+		kubeOpts.QPS = float32(kubeQPS)
+		log.Printf("Kube QPS: %v\n", kubeOpts.QPS)
+	}
+
+	kubeBurstStr := getenv("KUBEXIT_KUBE_BURST")
+	if kubeBurstStr != "" {
+		kubeOpts.Burst, err = strconv.Atoi(kubeBurstStr)
+		if err != nil {
+			log.Printf("Error: failed to parse kube burst: %v\n", err)
+			os.Exit(2)
+		}
+		log.Printf("Kube Burst: %d\n", kubeOpts.Burst)
+	}
+
+	enableEvents := false
+	enableEventsStr := getenv("KUBEXIT_EVENTS")
+	if enableEventsStr != "" {
+		enableEvents, err = strconv.ParseBool(enableEventsStr)
+		if err != nil {
+			log.Printf("Error: failed to parse events: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	log.Printf("Events: %v\n", enableEvents)
+
+	annotateTombstone := false
+	annotateTombstoneStr := getenv("KUBEXIT_TOMBSTONE_ANNOTATION")
+	if annotateTombstoneStr != "" {
+		annotateTombstone, err = strconv.ParseBool(annotateTombstoneStr)
+		if err != nil {
+			log.Printf("Error: failed to parse tombstone annotation: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if annotateTombstone {
+		_, err = kubernetes.TombstoneAnnotationKey(name)
+		if err != nil {
+			log.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	log.Printf("Tombstone Annotation: %v\n", annotateTombstone)
+
+	readinessGate := getenv("KUBEXIT_READINESS_GATE")
+	if readinessGate == "" {
+		log.Println("Readiness Gate: N/A")
+	} else {
+		log.Printf("Readiness Gate: %s\n", readinessGate)
+	}
+
+	terminationMessagePath := getenv("KUBEXIT_TERMINATION_MESSAGE_PATH")
+	if terminationMessagePath == "" {
+		terminationMessagePath = termination.DefaultPath
+	}
+	log.Printf("Termination Message Path: %s\n", terminationMessagePath)
+
+	var terminationMessageLines int
+	terminationMessageLinesStr := getenv("KUBEXIT_TERMINATION_MESSAGE_LINES")
+	if terminationMessageLinesStr != "" {
+		terminationMessageLines, err = strconv.Atoi(terminationMessageLinesStr)
+		if err != nil {
+			log.Printf("Error: failed to parse termination message lines: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	log.Printf("Termination Message Lines: %d\n", terminationMessageLines)
+
+	if opts.printConfig {
+		printSettings(os.Stdout, map[string]string{
+			"KUBEXIT_NAME":                      name,
+			"KUBEXIT_GRAVEYARD":                 graveyard,
+			"KUBEXIT_TOPOLOGY":                  topologyPath,
+			"KUBEXIT_ANNOTATIONS_PATH":          annotationsPath,
+			"KUBEXIT_BIRTH_DEPS":                joinDeps(birthDeps),
+			"KUBEXIT_BIRTH_TIMEOUT":             birthTimeout.String(),
+			"KUBEXIT_BIRTH_STABILITY":           birthStability.String(),
+			"KUBEXIT_DEATH_DEPS":                strings.Join(deathDeps, ","),
+			"KUBEXIT_GRACE_PERIOD":              gracePeriod.String(),
+			"KUBEXIT_RESTART_POLICY":            string(restartPolicy.Restart),
+			"KUBEXIT_MAX_RESTARTS":              strconv.Itoa(restartPolicy.MaxRestarts),
+			"KUBEXIT_RESTART_BACKOFF":           restartPolicy.Backoff.String(),
+			"KUBEXIT_MAX_RESTART_BACKOFF":       restartPolicy.MaxBackoff.String(),
+			"KUBEXIT_FATE_GROUP":                fateGroup,
+			"KUBEXIT_ROLE":                      string(role),
+			"KUBEXIT_PRIMARIES":                 strconv.Itoa(minPrimaries),
+			"KUBEXIT_POD_NAME":                  podName,
+			"KUBEXIT_NAMESPACE":                 namespace,
+			"KUBEXIT_KUBE_CONTEXT":              kubeOpts.Context,
+			"KUBEXIT_KUBE_QPS":                  kubeQPSStr,
+			"KUBEXIT_KUBE_BURST":                kubeBurstStr,
+			"KUBEXIT_EVENTS":                    strconv.FormatBool(enableEvents),
+			"KUBEXIT_TOMBSTONE_ANNOTATION":      strconv.FormatBool(annotateTombstone),
+			"KUBEXIT_READINESS_GATE":            readinessGate,
+			"KUBEXIT_TERMINATION_MESSAGE_PATH":  terminationMessagePath,
+			"KUBEXIT_TERMINATION_MESSAGE_LINES": strconv.Itoa(terminationMessageLines),
+		})
+		os.Exit(0)
+	}
+
+	for _, dep := range birthDeps {
+		ts.BirthDeps = append(ts.BirthDeps, dep.String())
+	}
+	if len(birthDeps) > 0 {
+		ts.BirthTimeout = birthTimeout.String()
+		ts.BirthStability = birthStability.String()
+	}
+	ts.DeathDeps = deathDeps
+	ts.GracePeriod = gracePeriod.String()
+	ts.Role = role
+	ts.FateGroup = fateGroup
+
 	child := supervisor.New(args[0], args[1:]...)
+	child.TailOutput(terminationMessageLines)
+	term := termination.New(terminationMessagePath)
+
+	// nil recorder records nothing
+	var recorder *kubernetes.Recorder
+	var clients *kubernetes.Clients
+	// nil gate sets nothing
+	var gate *readiness
+
+	if len(birthDeps) > 0 || enableEvents || annotateTombstone || readinessGate != "" {
+		var configNamespace string
+		clients, configNamespace, err = newKubeClients(kubeOpts)
+		if err == nil {
+			namespace, err = discoverNamespace(namespace, configNamespace)
+		}
+		if err != nil {
+			if len(birthDeps) > 0 || readinessGate != "" {
+				fatalf(child, ts, recorder, term, "Error: %v\n", err)
+			}
+			// events and annotations are optional
+			log.Printf("Warning: events and tombstone annotation disabled: %v\n", err)
+			enableEvents = false
+			annotateTombstone = false
+		}
+		requirePodName := hasContainerDeps(birthDeps) || readinessGate != ""
+		discoverPodName := podName == "" && (requirePodName || enableEvents || annotateTombstone)
+		if len(birthDeps) > 0 || annotateTombstone || readinessGate != "" {
+			err = checkPermissions(clients, birthDeps, namespace, discoverPodName, annotateTombstone, readinessGate != "")
+			if err != nil {
+				fatalf(child, ts, recorder, term, "Error: %v\n", err)
+			}
+		}
+		if discoverPodName {
+			podName, err = discoverPod(clients, name, namespace, annotationsPath)
+			if err != nil {
+				if requirePodName {
+					fatalf(child, ts, recorder, term, "Error: %v\n", err)
+				}
+				// events and annotations are optional
+				log.Printf("Warning: events and tombstone annotation disabled: %v\n", err)
+				enableEvents = false
+				annotateTombstone = false
+			}
+		}
+		if enableEvents {
+			recorder = newRecorder(clients, namespace, podName, name)
+			child.OnShutdown(onShutdownEvent(recorder, gracePeriod))
+		}
+		if annotateTombstone {
+			ts.OnWrite = onTombstoneWrite(clients, namespace, podName)
+		}
+		if readinessGate != "" {
+			gate = newReadiness(clients, namespace, podName, readinessGate)
+			child.OnShutdown(onShutdownReadinessGate(gate))
+		}
+	}
+
+	child.SetRestartPolicy(restartPolicy)
+	child.OnRestart(onRestart(ts, recorder, gate))
+	child.OnRestarted(onRestarted(gate))
 
 	// watch for death deps early, so they can interrupt waiting for birth deps
 	if len(deathDeps) > 0 {
@@ -126,161 +442,752 @@ func main() {
 		defer stopGraveyardWatcher()
 
 		log.Println("Watching graveyard...")
-		err = tombstone.Watch(ctx, graveyard, onDeathOfAny(deathDeps, func() {
+		err = tombstone.Watch(ctx, graveyard, onDeathOfAny(deathDeps, func(dead *tombstone.Tombstone) {
 			stopGraveyardWatcher()
-			// trigger graceful shutdown
-			// Skipped if not started.
-			err := child.ShutdownWithTimeout(gracePeriod)
-			// ShutdownWithTimeout doesn't block until timeout
-			if err != nil {
-				log.Printf("Error: failed to shutdown: %v\n", err)
+			recorder.Eventf("DeathDependency", "Death dependency %s exited(%d)", dead.Name, exitCodeOf(dead))
+			term.SetReason("terminated: death dependency %s exited %d", dead.Name, exitCodeOf(dead))
+			shutdownChild(child, gracePeriod)
+		}))
+		if err != nil {
+			fatalf(child, ts, recorder, term, "Error: failed to watch graveyard: %v\n", err)
+		}
+	}
+
+	// Write the tombstone of a primary early, so that sidecars don't exit
+	// when other primaries die before this one is born.
+	if role == tombstone.RolePrimary {
+		err = ts.Write()
+		if err != nil {
+			fatalf(child, ts, recorder, term, "Error: failed to create tombstone: %v\n", err)
+		}
+	}
+
+	// shutdown sidecars once every primary has died
+	var onPrimariesDied func([]*tombstone.Tombstone)
+	if role == tombstone.RoleSidecar {
+		ctx, stopPrimariesWatcher := context.WithCancel(context.Background())
+		// stop primaries watcher on exit, if not sooner
+		defer stopPrimariesWatcher()
+
+		var once sync.Once
+		onPrimariesDied = func(primaries []*tombstone.Tombstone) {
+			once.Do(func() {
+				stopPrimariesWatcher()
+				names := tombstoneNames(primaries)
+				recorder.Eventf("PrimariesExited", "All primary processes exited: %s", names)
+				term.SetReason("terminated: all primary processes exited: %s", names)
+				shutdownChild(child, gracePeriod)
+			})
+		}
+
+		log.Println("Watching graveyard for primaries...")
+		err = tombstone.Watch(ctx, graveyard, onDeathOfPrimaries(name, minPrimaries, onPrimariesDied))
+		if err != nil {
+			fatalf(child, ts, recorder, term, "Error: failed to watch graveyard: %v\n", err)
+		}
+	}
+
+	// canceled to stop waiting for birth deps
+	birthCtx, stopWaitingForBirthDeps := context.WithCancel(context.Background())
+	defer stopWaitingForBirthDeps()
+
+	// fail fast with the other members of the fate group
+	// nil fate never fails
+	var memberFate *fate
+	if fateGroup != "" {
+		memberFate = &fate{}
+		ctx, stopFateWatcher := context.WithCancel(context.Background())
+		// stop fate watcher on exit, if not sooner
+		defer stopFateWatcher()
+
+		onFailure := func(origin string, code int) {
+			if !memberFate.fail(origin, code) {
+				return
 			}
+			stopFateWatcher()
+			stopWaitingForBirthDeps()
+			recorder.Warningf("FateGroupFailed", "Fate group %s member %s exited(%d)", fateGroup, origin, code)
+			term.SetReason("terminated: fate group %s member %s exited %d", fateGroup, origin, code)
+			shutdownChild(child, gracePeriod)
+		}
+		log.Println("Watching graveyard for fate group failures...")
+		err = tombstone.Watch(ctx, graveyard, onFateGroupFailure(name, fateGroup, onFailure))
+		if err != nil {
+			fatalf(child, ts, recorder, term, "Error: failed to watch graveyard: %v\n", err)
+		}
+		// another member may have failed before the graveyard was watched
+		checkFateGroupFailed(graveyard, name, fateGroup, onFailure)
+	}
+
+	// watch for shutdown requests early, so they can interrupt waiting for birth deps
+	if annotationsPath != "" {
+		ctx, stopAnnotationsWatcher := context.WithCancel(context.Background())
+		// stop annotations watcher on exit, if not sooner
+		defer stopAnnotationsWatcher()
+
+		log.Println("Watching annotations...")
+		shutdownKey := podinfo.ShutdownAnnotationPrefix + name
+		err = podinfo.WatchAnnotations(ctx, annotationsPath, onShutdownRequest(shutdownKey, annotations[shutdownKey], func() {
+			stopAnnotationsWatcher()
+			term.SetReason("terminated: shutdown requested by annotation %s", shutdownKey)
+			recorder.Eventf("ShutdownRequested", "Shutdown requested by annotation %s", shutdownKey)
+			shutdownChild(child, gracePeriod)
 		}))
 		if err != nil {
-			fatalf(child, ts, "Error: failed to watch graveyard: %v\n", err)
+			fatalf(child, ts, recorder, term, "Error: failed to watch annotations: %v\n", err)
 		}
 	}
 
 	if len(birthDeps) > 0 {
-		err = waitForBirthDeps(birthDeps, namespace, podName, birthTimeout)
+		err = waitForBirthDeps(birthCtx, clients, ts, birthDeps, namespace, podName, birthTimeout, birthStability)
+		// interruption by a fate group failure is handled below
+		if _, _, failed := memberFate.failure(); err != nil && !failed {
+			recorder.Warningf("BirthDepsFailed", "%v", err)
+			fatalf(child, ts, recorder, term, "Error: %v\n", err)
+		}
+		if err == nil {
+			recorder.Eventf("BirthDepsReady", "All birth deps ready: %s", joinDeps(birthDeps))
+		}
+	}
+	// Done waiting for birth deps, so that fate group failures after this
+	// only shutdown the child process.
+	stopWaitingForBirthDeps()
+
+	if origin, _, failed := memberFate.failure(); failed {
+		// don't start the child process, if another member already failed
+		log.Printf("Skipping start: fate group member %s failed\n", origin)
+		code, err := memberFate.recordDeath(ts, -1)
+		writeTerminationMessage(term, code, child)
+		ts.WaitForHooks()
+		recorder.Flush(eventFlushTimeout)
 		if err != nil {
-			fatalf(child, ts, "Error: %v\n", err)
+			log.Printf("Error: %v\n", err)
+			os.Exit(1)
 		}
+		os.Exit(code)
 	}
 
 	err = child.Start()
 	if err != nil {
-		fatalf(child, ts, "Error: %v\n", err)
+		recorder.Warningf("FailedStart", "%v", err)
+		fatalf(child, ts, recorder, term, "Error: %v\n", err)
+	}
+	recorder.Eventf("Started", "Started child process: %s", child)
+	if _, _, failed := memberFate.failure(); failed {
+		// another member failed while starting, before shutdown could be
+		// triggered. Errors if already shutting down.
+		_ = child.ShutdownWithTimeout(gracePeriod)
 	}
+	gate.set(corev1.ConditionTrue, "Started", "Child process started")
 
 	err = ts.RecordBirth()
 	if err != nil {
-		fatalf(child, ts, "Error: %v\n", err)
+		fatalf(child, ts, recorder, term, "Error: %v\n", err)
+	}
+
+	// every primary may have died before the child started
+	if onPrimariesDied != nil {
+		checkPrimariesDied(graveyard, minPrimaries, onPrimariesDied)
 	}
 
 	code := waitForChildExit(child)
+	recordExitEvent(recorder, code)
+	gate.shutdown("Exited", fmt.Sprintf("Child process exited(%d)", code))
+	gate.wait()
 
-	err = ts.RecordDeath(code)
+	// the exit code of a failed fate group member is propagated
+	code, err = memberFate.recordDeath(ts, code)
+	writeTerminationMessage(term, code, child)
 	if err != nil {
 		log.Printf("Error: %v\n", err)
+		ts.WaitForHooks()
+		recorder.Flush(eventFlushTimeout)
 		os.Exit(1)
 	}
 
+	ts.WaitForHooks()
+	recorder.Flush(eventFlushTimeout)
 	os.Exit(code)
 }
 
-func waitForBirthDeps(birthDeps []string, namespace, podName string, timeout time.Duration) error {
-	// Cancel context on SIGTERM to trigger graceful exit
-	ctx := withCancelOnSignal(context.Background(), syscall.SIGTERM)
+// graveyardPath returns the cleaned graveyard path, or the default.
+func graveyardPath() string {
+	graveyard := getenv("KUBEXIT_GRAVEYARD")
+	if graveyard == "" {
+		return "/graveyard"
+	}
+	graveyard = strings.TrimRight(graveyard, "/")
+	return filepath.Clean(graveyard)
+}
+
+// writeTerminationMessage writes the termination message, logging any error.
+func writeTerminationMessage(term *termination.Message, code int, child *supervisor.Supervisor) {
+	err := term.Write(code, child.OutputTail())
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+	}
+}
+
+// eventFlushTimeout is the maximum time to wait for events to be written
+// before exiting.
+const eventFlushTimeout = 5 * time.Second
+
+// newRecorder returns an event recorder for this container, or nil if events
+// are not allowed.
+func newRecorder(clients *kubernetes.Clients, namespace, podName, name string) *kubernetes.Recorder {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return kubernetes.NewRecorder(ctx, clients.Kube, namespace, podName, name)
+}
+
+// onTombstoneWrite returns a WriteHook that mirrors the tombstone into a pod
+// annotation. Failures are logged, but not fatal.
+func onTombstoneWrite(clients *kubernetes.Clients, namespace, podName string) tombstone.WriteHook {
+	return func(t *tombstone.Tombstone) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		key, err := kubernetes.TombstoneAnnotationKey(t.Name)
+		if err != nil {
+			log.Printf("Warning: failed to annotate tombstone: %v\n", err)
+			return
+		}
+		err = kubernetes.AnnotatePod(ctx, clients.Kube, namespace, podName, map[string]string{
+			key: t.String(),
+		})
+		if err != nil {
+			log.Printf("Warning: failed to annotate tombstone: %v\n", err)
+			return
+		}
+		log.Printf("Annotated tombstone: %s\n", key)
+	}
+}
+
+// onShutdownEvent returns a ShutdownHook that records shutdown escalation
+// events.
+func onShutdownEvent(recorder *kubernetes.Recorder, gracePeriod time.Duration) supervisor.ShutdownHook {
+	return func(sig os.Signal) {
+		if sig == syscall.SIGKILL {
+			recorder.Warningf("Killing", "Killing child process")
+			return
+		}
+		recorder.Eventf("Terminating", "Terminating child process (grace period: %s)", gracePeriod)
+	}
+}
+
+// recordExitEvent records the child exit code as an event.
+func recordExitEvent(recorder *kubernetes.Recorder, code int) {
+	if code == 0 {
+		recorder.Eventf("Exited", "Child process exited(0)")
+		return
+	}
+	recorder.Warningf("Exited", "Child process exited(%d)", code)
+}
+
+// exitCodeOf returns the tombstone exit code, or -1 if unknown.
+func exitCodeOf(ts *tombstone.Tombstone) int {
+	if ts.ExitCode == nil {
+		return -1
+	}
+	return *ts.ExitCode
+}
 
-	ctx, stopPodWatcher := context.WithTimeout(ctx, timeout)
-	// Stop pod watcher on exit, if not sooner
-	defer stopPodWatcher()
+// firstNonEmpty returns the first non-empty value, or empty if all are empty.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// newKubeClients returns kubernetes clients for the supplied options, and the
+// namespace of the kubeconfig context, if any.
+func newKubeClients(opts kubernetes.ConfigOptions) (*kubernetes.Clients, string, error) {
+	config, namespace, err := kubernetes.NewConfig(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	clients, err := kubernetes.NewClients(config)
+	if err != nil {
+		return nil, "", err
+	}
+	return clients, namespace, nil
+}
+
+// discoverNamespace returns the namespace, if specified, otherwise the
+// namespace of the kubeconfig context, if any, otherwise the namespace of
+// the pod service account.
+func discoverNamespace(namespace, configNamespace string) (string, error) {
+	if namespace != "" {
+		return namespace, nil
+	}
+	if configNamespace != "" {
+		log.Printf("Namespace: %s (kubeconfig)\n", configNamespace)
+		return configNamespace, nil
+	}
+	namespace, err := kubernetes.DiscoverNamespace()
+	if err != nil {
+		return "", fmt.Errorf("%v: set KUBEXIT_NAMESPACE explicitly", err)
+	}
+	log.Printf("Namespace: %s (discovered)\n", namespace)
+	return namespace, nil
+}
+
+// discoverPod returns the discovered pod name. The pod name is read from the
+// Downward API volume of the annotations file, if any, because the hostname
+// is truncated for long pod names.
+func discoverPod(clients *kubernetes.Clients, name, namespace, annotationsPath string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var podInfoDir string
+	if annotationsPath != "" {
+		podInfoDir = filepath.Dir(annotationsPath)
+	}
+	podName, err := kubernetes.DiscoverPodName(ctx, clients.Kube, namespace, name, podInfoDir)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Pod Name: %s (discovered)\n", podName)
+	return podName, nil
+}
+
+// checkPermissions checks that the client has permission to watch all of the
+// birth deps, and to patch the pod for the tombstone annotation and readiness
+// gate, if enabled. Returns an error with the RBAC YAML required to grant any
+// missing permissions. The check is skipped if access reviews fail.
+func checkPermissions(clients *kubernetes.Clients, birthDeps []birth.Dependency, namespace string, discoverPodName, annotateTombstone, readinessGate bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	perms, err := requiredPermissions(clients, birthDeps, namespace, discoverPodName, annotateTombstone, readinessGate)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Checking RBAC permissions...")
+	missing, err := kubernetes.CheckPermissions(ctx, clients.Kube, perms)
+	if err != nil {
+		log.Printf("Warning: skipping RBAC permission check: %v\n", err)
+		return nil
+	}
+	if len(missing) == 0 {
+		return nil
+	}
 
-	log.Println("Watching pod updates...")
-	err := kubernetes.WatchPod(ctx, namespace, podName,
-		onReadyOfAll(birthDeps, stopPodWatcher),
-	)
+	missingStrs := make([]string, 0, len(missing))
+	for _, perm := range missing {
+		missingStrs = append(missingStrs, perm.String())
+	}
+
+	saNamespace, saName, err := kubernetes.ServiceAccount(ctx, clients.Kube)
+	if err != nil {
+		log.Printf("Warning: failed to identify service account: %v\n", err)
+		saNamespace, saName = namespace, "<service-account>"
+	}
+	rbacYAML, err := kubernetes.RBACYAML(missing, saNamespace, saName, "kubexit")
 	if err != nil {
-		return fmt.Errorf("failed to watch pod: %v", err)
+		return err
+	}
+	return fmt.Errorf("missing RBAC permissions:\n- %s\nApply the following to grant them:\n%s",
+		strings.Join(missingStrs, "\n- "), rbacYAML)
+}
+
+// requiredPermissions returns the permissions required to watch the birth
+// deps, and to patch the pod for the tombstone annotation and readiness gate.
+func requiredPermissions(clients *kubernetes.Clients, birthDeps []birth.Dependency, namespace string, discoverPodName, annotateTombstone, readinessGate bool) ([]kubernetes.Permission, error) {
+	var perms []kubernetes.Permission
+	add := func(group, resource, namespace string, verbs ...string) {
+		for i, perm := range perms {
+			if perm.Group == group && perm.Resource == resource && perm.Namespace == namespace {
+				for _, verb := range verbs {
+					if !slices.Contains(perm.Verbs, verb) {
+						perms[i].Verbs = append(perms[i].Verbs, verb)
+					}
+				}
+				return
+			}
+		}
+		perms = append(perms, kubernetes.Permission{Group: group, Resource: resource, Namespace: namespace, Verbs: verbs})
+	}
+
+	if discoverPodName {
+		add("", "pods", namespace, "get")
+	}
+	if annotateTombstone {
+		add("", "pods", namespace, "patch")
+	}
+	if readinessGate {
+		add("", "pods/status", namespace, "patch")
+	}
+	for _, dep := range birthDeps {
+		switch dep.Kind {
+		case birth.KindService:
+			add("discovery.k8s.io", "endpointslices", namespace, "list", "watch")
+		case birth.KindPods:
+			add("", "pods", namespace, "list", "watch")
+		case birth.KindObject:
+			mapping, err := clients.Mapper.RESTMapping(dep.GVK.GroupKind(), dep.GVK.Version)
+			if err != nil {
+				return nil, fmt.Errorf("failed to map kind to resource: %s: %v", dep.GVK, err)
+			}
+			objNamespace := dep.Namespace
+			if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+				objNamespace = ""
+			} else if objNamespace == "" {
+				objNamespace = namespace
+			}
+			add(mapping.Resource.Group, mapping.Resource.Resource, objNamespace, "get", "list", "watch")
+		default:
+			add("", "pods", namespace, "list", "watch")
+		}
+	}
+	return perms, nil
+}
+
+func waitForBirthDeps(ctx context.Context, clients *kubernetes.Clients, ts *tombstone.Tombstone, birthDeps []birth.Dependency, namespace, podName string, timeout, stability time.Duration) error {
+	// Cancel context on SIGTERM to trigger graceful exit
+	ctx, stopSignalWatcher := withCancelOnSignal(ctx, syscall.SIGTERM)
+	defer stopSignalWatcher()
+
+	ctx, stopWatchers := context.WithTimeout(ctx, timeout)
+	// Stop watchers on exit, if not sooner
+	defer stopWatchers()
+
+	// Closed by the tracker when all birth deps are ready.
+	// Distinguishes success from cancellation by signal.
+	readyCh := make(chan struct{})
+	tracker := birth.NewTracker(birthDeps, stability, func() {
+		close(readyCh)
+	})
+
+	// Receives terminal watch errors.
+	// Buffered, so that watch goroutines never block after we stop reading.
+	watchErrCh := make(chan error, len(birthDeps))
+
+	// Receives a deadlock error, if a birth dep cycle is detected.
+	// Nil (blocks forever) without container deps, which cannot deadlock.
+	var deadlockCh chan error
+	if hasContainerDeps(birthDeps) {
+		deadlockCh = make(chan error, 1)
+		stopWaiting, err := detectDeadlock(ctx, ts, tracker, deadlockCh)
+		if err != nil {
+			return err
+		}
+		defer stopWaiting()
+	}
+
+	var containerDeps []birth.Dependency
+	for _, dep := range birthDeps {
+		switch dep.Kind {
+		case birth.KindService:
+			log.Printf("Watching service endpoints: %s\n", dep.Name)
+			resultCh, err := kubernetes.WatchServiceEndpoints(ctx, clients.Kube, namespace, dep.Name, onServiceEndpoints(tracker, dep))
+			if err != nil {
+				return fmt.Errorf("failed to watch service endpoints: %v", err)
+			}
+			go forwardWatchErr(resultCh, watchErrCh, fmt.Sprintf("service %s", dep.Name))
+		case birth.KindPods:
+			log.Printf("Watching pods: %s\n", dep.Selector)
+			resultCh, err := kubernetes.WatchPods(ctx, clients.Kube, namespace, dep.Selector, onPods(tracker, dep))
+			if err != nil {
+				return fmt.Errorf("failed to watch pods: %v", err)
+			}
+			go forwardWatchErr(resultCh, watchErrCh, fmt.Sprintf("pods %s", dep.Selector))
+		case birth.KindObject:
+			log.Printf("Watching object: %s\n", dep)
+			resultCh, err := kubernetes.WatchObject(ctx, clients.Dynamic, clients.Mapper, dep.GVK, dep.Namespace, namespace, dep.Name, onObjectCondition(tracker, dep))
+			if err != nil {
+				return fmt.Errorf("failed to watch object: %v", err)
+			}
+			go forwardWatchErr(resultCh, watchErrCh, fmt.Sprintf("object %s", dep))
+		default:
+			containerDeps = append(containerDeps, dep)
+		}
+	}
+
+	if len(containerDeps) > 0 {
+		log.Println("Watching pod updates...")
+		resultCh := kubernetes.WatchPod(ctx, clients.Kube, namespace, podName,
+			onReadyOfAll(tracker, containerDeps),
+		)
+		go forwardWatchErr(resultCh, watchErrCh, fmt.Sprintf("pod %s", podName))
 	}
 
 	// Block until all birth deps are ready
-	<-ctx.Done()
-	err = ctx.Err()
-	if err == context.DeadlineExceeded {
-		return fmt.Errorf("timed out waiting for birth deps to be ready: %s", timeout)
-	} else if err != nil && err != context.Canceled {
-		// ignore canceled. shouldn't be other errors, but just in case...
-		return fmt.Errorf("waiting for birth deps to be ready: %v", err)
+	select {
+	case <-readyCh:
+		log.Printf("All birth deps ready: %v\n", joinDeps(birthDeps))
+		return nil
+	case err := <-watchErrCh:
+		return fmt.Errorf("failed waiting for birth deps to be ready: %v", err)
+	case err := <-deadlockCh:
+		return err
+	case <-ctx.Done():
+		err := ctx.Err()
+		if err == context.DeadlineExceeded {
+			return fmt.Errorf("timed out waiting for birth deps to be ready: %s", timeout)
+		}
+		return fmt.Errorf("interrupted waiting for birth deps to be ready: %v", err)
+	}
+}
+
+// detectDeadlock publishes the container birth deps that the process is
+// waiting for in its tombstone, and watches the graveyard for a cycle of
+// processes waiting for each other, which would otherwise wait until the
+// birth timeout. Sends an error naming the cycle to deadlockCh, if found.
+// Returns a func to stop publishing, which must be called before the
+// tombstone is written again.
+func detectDeadlock(ctx context.Context, ts *tombstone.Tombstone, tracker *birth.Tracker, deadlockCh chan<- error) (func(), error) {
+	var lock sync.Mutex
+	stopped := false
+
+	check := func() {
+		cycle, err := findDeadlock(ts.Graveyard, ts.Name)
+		if err != nil {
+			log.Printf("Warning: %v\n", err)
+			return
+		}
+		if cycle == nil {
+			return
+		}
+		select {
+		case deadlockCh <- fmt.Errorf("birth dep deadlock: processes are waiting for each other: %s", strings.Join(cycle, " -> ")):
+		default:
+			// already detected
+		}
 	}
 
-	log.Printf("All birth deps ready: %v\n", strings.Join(birthDeps, ", "))
-	return nil
+	publish := func(unmet []birth.Dependency) {
+		var names []string
+		for _, dep := range unmet {
+			if dep.Kind == birth.KindContainer {
+				names = append(names, dep.Name)
+			}
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		if stopped {
+			return
+		}
+		err := ts.RecordWaiting(names)
+		if err != nil {
+			log.Printf("Warning: %v\n", err)
+			return
+		}
+		check()
+	}
+
+	tracker.OnChange(publish)
+	publish(tracker.Unmet())
+
+	log.Printf("Watching graveyard for birth dep deadlocks: %s\n", ts.Graveyard)
+	err := tombstone.Watch(ctx, ts.Graveyard, func(event fsnotify.Event) {
+		if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+			return
+		}
+		check()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch graveyard: %v", err)
+	}
+
+	return func() {
+		lock.Lock()
+		defer lock.Unlock()
+		stopped = true
+	}, nil
 }
 
-// withCancelOnSignal calls cancel when one of the specified signals is recieved.
-func withCancelOnSignal(ctx context.Context, signals ...os.Signal) context.Context {
+// findDeadlock returns a cycle of processes in the graveyard that are waiting
+// for each other to be born, through the named process, or nil if none.
+// Processes that were born or died are not waiting.
+func findDeadlock(graveyard, name string) ([]string, error) {
+	tombstones, err := tombstone.ReadAll(graveyard)
+	if err != nil {
+		return nil, err
+	}
+	waitGraph := map[string][]string{}
+	for _, other := range tombstones {
+		if other.Born == nil && other.Died == nil {
+			waitGraph[other.Name] = other.WaitingFor
+		}
+	}
+	return topology.FindCycleThrough(waitGraph, name), nil
+}
+
+// forwardWatchErr forwards a non-nil watch result to errCh.
+// A nil result means the watch was stopped by context cancellation.
+func forwardWatchErr(resultCh <-chan error, errCh chan<- error, desc string) {
+	err, ok := <-resultCh
+	if !ok || err == nil {
+		return
+	}
+	if err == kubernetes.ErrDeleted {
+		errCh <- fmt.Errorf("%s deleted", desc)
+		return
+	}
+	errCh <- fmt.Errorf("failed to watch %s: %v", desc, err)
+}
+
+// withCancelOnSignal returns a context that is canceled when one of the
+// specified signals is received. The returned cancel func stops listening for
+// the signals.
+func withCancelOnSignal(ctx context.Context, signals ...os.Signal) (context.Context, context.CancelFunc) {
 	ctx, cancel := context.WithCancel(ctx)
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, signals...)
 
-	// Trigger context cancel on SIGTERM
 	go func() {
-		for {
-			select {
-			case s, ok := <-sigCh:
-				if !ok {
-					return
-				}
-				log.Printf("Received shutdown signal: %v", s)
-				cancel()
-			case <-ctx.Done():
-				signal.Reset()
-				close(sigCh)
-			}
+		// Stop only this channel, so that the supervisor keeps receiving
+		// signals to forward to the child process.
+		defer signal.Stop(sigCh)
+		select {
+		case s := <-sigCh:
+			log.Printf("Received shutdown signal: %v", s)
+			cancel()
+		case <-ctx.Done():
 		}
 	}()
 
-	return ctx
+	return ctx, cancel
+}
+
+// shutdownChild triggers a graceful shutdown of the child process, which is
+// killed if it doesn't exit within the grace period. Skipped if not started.
+func shutdownChild(child *supervisor.Supervisor, gracePeriod time.Duration) {
+	err := child.ShutdownWithTimeout(gracePeriod)
+	// ShutdownWithTimeout doesn't block until timeout
+	if err != nil {
+		log.Printf("Error: failed to shutdown: %v\n", err)
+	}
 }
 
 // wait for the child to exit and return the exit code
 func waitForChildExit(child *supervisor.Supervisor) int {
-	var code int
 	err := child.Wait()
+	code := supervisor.ExitCode(err)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			code = exitErr.ProcessState.ExitCode()
-		} else {
-			code = -1
-		}
 		log.Printf("Child Exited(%d): %v\n", code, err)
 	} else {
-		code = 0
 		log.Println("Child Exited(0)")
 	}
 	return code
 }
 
+// newRestartPolicy returns a restart policy, with default backoff durations.
+func newRestartPolicy(restart string, maxRestarts int, backoff, maxBackoff string) (supervisor.RestartPolicy, error) {
+	policy := supervisor.RestartPolicy{
+		MaxRestarts: maxRestarts,
+		Backoff:     time.Second,
+		MaxBackoff:  5 * time.Minute,
+	}
+	var err error
+	policy.Restart, err = supervisor.ParseRestart(restart)
+	if err != nil {
+		return policy, err
+	}
+	if maxRestarts < 0 {
+		return policy, fmt.Errorf("invalid max restarts: %d: must not be negative", maxRestarts)
+	}
+	if backoff != "" {
+		policy.Backoff, err = time.ParseDuration(backoff)
+		if err != nil {
+			return policy, fmt.Errorf("failed to parse restart backoff: %v", err)
+		}
+	}
+	if policy.Backoff < 0 {
+		return policy, fmt.Errorf("invalid restart backoff: %s: must not be negative", policy.Backoff)
+	}
+	if maxBackoff != "" {
+		policy.MaxBackoff, err = time.ParseDuration(maxBackoff)
+		if err != nil {
+			return policy, fmt.Errorf("failed to parse max restart backoff: %v", err)
+		}
+	}
+	if policy.MaxBackoff <= 0 {
+		return policy, fmt.Errorf("invalid max restart backoff: %s: must be positive", policy.MaxBackoff)
+	}
+	return policy, nil
+}
+
+// formatRestartPolicy returns the restart policy, with its limits, if any.
+func formatRestartPolicy(policy supervisor.RestartPolicy) string {
+	if policy.Restart == supervisor.RestartNever {
+		return string(policy.Restart)
+	}
+	return fmt.Sprintf("%s (max restarts: %d, backoff: %s, max backoff: %s)",
+		policy.Restart, policy.MaxRestarts, policy.Backoff, policy.MaxBackoff)
+}
+
+// onRestart returns a RestartHook that records the restart in the tombstone
+// and as an event, and sets the readiness gate to False during the backoff.
+// The tombstone is not marked dead, so death deps are not triggered by
+// restarts.
+func onRestart(ts *tombstone.Tombstone, recorder *kubernetes.Recorder, gate *readiness) supervisor.RestartHook {
+	return func(restarts, code int, delay time.Duration) {
+		recorder.Warningf("BackOff", "Child process exited(%d): restarting in %s (restart %d)", code, delay, restarts)
+		gate.set(corev1.ConditionFalse, "BackOff", fmt.Sprintf("Child process exited(%d): restarting in %s", code, delay))
+		err := ts.RecordRestart(restarts, code)
+		if err != nil {
+			log.Printf("Error: %v\n", err)
+		}
+	}
+}
+
+// onRestarted returns a RestartedHook that sets the readiness gate back to
+// True once the child process has restarted.
+func onRestarted(gate *readiness) supervisor.RestartedHook {
+	return func(restarts int) {
+		gate.set(corev1.ConditionTrue, "Started", fmt.Sprintf("Child process restarted (restart %d)", restarts))
+	}
+}
+
 // fatalf is for terminal errors.
 // The child process may or may not be running.
-func fatalf(child *supervisor.Supervisor, ts *tombstone.Tombstone, msg string, args ...interface{}) {
+func fatalf(child *supervisor.Supervisor, ts *tombstone.Tombstone, recorder *kubernetes.Recorder, term *termination.Message, msg string, args ...interface{}) {
 	log.Printf(msg, args...)
+	term.SetReason("%s", strings.TrimSpace(fmt.Sprintf(msg, args...)))
 
 	// Skipped if not started.
 	err := child.ShutdownNow()
 	if err != nil {
 		log.Printf("Error: failed to shutdown child process: %v", err)
+		ts.WaitForHooks()
+		recorder.Flush(eventFlushTimeout)
 		os.Exit(1)
 	}
 
 	// Wait for shutdown...
 	//TODO: timout in case the process is zombie?
 	code := waitForChildExit(child)
+	// kubexit exits 1, regardless of the child exit code
+	writeTerminationMessage(term, 1, child)
 
 	// Attempt to record death, if possible.
 	// Another process may be waiting for it.
 	err = ts.RecordDeath(code)
 	if err != nil {
 		log.Printf("Error: %v\n", err)
+		ts.WaitForHooks()
+		recorder.Flush(eventFlushTimeout)
 		os.Exit(1)
 	}
 
+	ts.WaitForHooks()
+	recorder.Flush(eventFlushTimeout)
 	os.Exit(1)
 }
 
-// onReadyOfAll returns an EventHandler that executes the callback when all of
-// the birthDeps containers are ready.
-func onReadyOfAll(birthDeps []string, callback func()) kubernetes.EventHandler {
-	birthDepSet := map[string]struct{}{}
-	for _, depName := range birthDeps {
-		birthDepSet[depName] = struct{}{}
-	}
-
+// onReadyOfAll returns an EventHandler that updates the tracker when any of
+// the containerDeps become ready (or reach their other specified condition:
+// started, completed, succeeded).
+func onReadyOfAll(tracker *birth.Tracker, containerDeps []birth.Dependency) kubernetes.EventHandler {
 	return func(event watch.Event) {
-		fmt.Printf("Event Type: %v\n", event.Type)
+		log.Printf("Event Type: %v\n", event.Type)
 		// ignore Deleted (Watch will auto-stop on delete)
 		if event.Type == watch.Deleted {
 			return
@@ -292,29 +1199,152 @@ func onReadyOfAll(birthDeps []string, callback func()) kubernetes.EventHandler {
 			return
 		}
 
-		// Convert ContainerStatuses list to map of ready container names
-		readyContainers := map[string]struct{}{}
-		for _, status := range pod.Status.ContainerStatuses {
-			if status.Ready {
-				readyContainers[status.Name] = struct{}{}
-			}
+		for _, dep := range containerDeps {
+			tracker.Update(dep, dep.Met(pod))
 		}
+	}
+}
 
-		// Check if all birth deps are ready
-		for _, name := range birthDeps {
-			if _, ok := readyContainers[name]; !ok {
-				// at least one birth dep is not ready
-				return
-			}
+// onServiceEndpoints returns an EndpointSlicesHandler that updates the
+// tracker when the service has enough ready endpoints.
+func onServiceEndpoints(tracker *birth.Tracker, dep birth.Dependency) kubernetes.EndpointSlicesHandler {
+	return func(slices []*discoveryv1.EndpointSlice) {
+		tracker.Update(dep, dep.MetByEndpointSlices(slices))
+	}
+}
+
+// onPods returns a PodsHandler that updates the tracker when enough of the
+// selected pods are ready.
+func onPods(tracker *birth.Tracker, dep birth.Dependency) kubernetes.PodsHandler {
+	return func(pods []*corev1.Pod) {
+		tracker.Update(dep, dep.MetByPods(pods))
+	}
+}
+
+// onObjectCondition returns an EventHandler that updates the tracker when the
+// object has the dependency status condition.
+func onObjectCondition(tracker *birth.Tracker, dep birth.Dependency) kubernetes.EventHandler {
+	return func(event watch.Event) {
+		if event.Type == watch.Deleted {
+			tracker.Update(dep, false)
+			return
 		}
 
+		obj, ok := event.Object.(*unstructured.Unstructured)
+		if !ok {
+			log.Printf("Error: unexpected non-unstructured object type: %+v\n", event.Object)
+			return
+		}
+
+		tracker.Update(dep, dep.MetByObject(obj))
+	}
+}
+
+// hasContainerDeps returns true if any of the birth deps are sibling
+// containers, which requires watching this pod.
+func hasContainerDeps(deps []birth.Dependency) bool {
+	for _, dep := range deps {
+		if dep.Kind == birth.KindContainer {
+			return true
+		}
+	}
+	return false
+}
+
+// joinDeps returns the birth deps as a comma separated string.
+func joinDeps(deps []birth.Dependency) string {
+	strs := make([]string, 0, len(deps))
+	for _, dep := range deps {
+		strs = append(strs, dep.String())
+	}
+	return strings.Join(strs, ",")
+}
+
+// onShutdownRequest returns an AnnotationsHandler that executes the callback
+// when the shutdown annotation is set or changed to a non-empty value.
+// The initial value is ignored, so that a stale request doesn't shutdown a
+// restarted process.
+func onShutdownRequest(key, initialValue string, callback func()) podinfo.AnnotationsHandler {
+	lastValue := initialValue
+	return func(annotations map[string]string) {
+		value := annotations[key]
+		if value == lastValue {
+			return
+		}
+		lastValue = value
+		if value == "" {
+			return
+		}
+		log.Printf("Shutdown requested: %s=%q\n", key, value)
 		callback()
 	}
 }
 
+// onDeathOfPrimaries returns an EventHandler that executes the callback when
+// every tombstone with the primary role in the graveyard has died, and there
+// are at least minPrimaries of them.
+// Tombstones written later are included, so primaries may be added to the
+// pod without reconfiguring the sidecars.
+func onDeathOfPrimaries(self string, minPrimaries int, callback func([]*tombstone.Tombstone)) tombstone.EventHandler {
+	return func(event fsnotify.Event) {
+		if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+			// ignore other events
+			return
+		}
+		if filepath.Base(event.Name) == self {
+			// ignore own tombstone
+			return
+		}
+		checkPrimariesDied(filepath.Dir(event.Name), minPrimaries, callback)
+	}
+}
+
+// checkPrimariesDied executes the callback if every tombstone with the
+// primary role in the graveyard has died, and there are at least
+// minPrimaries of them.
+func checkPrimariesDied(graveyard string, minPrimaries int, callback func([]*tombstone.Tombstone)) {
+	tombstones, err := tombstone.ReadAll(graveyard)
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		return
+	}
+	primaries, died := tombstone.PrimariesDied(tombstones, minPrimaries)
+	if !died {
+		return
+	}
+	log.Printf("All primaries died: %s\n", tombstoneNames(primaries))
+	callback(primaries)
+}
+
+// parsePrimaries returns the minimum number of primaries that must die before
+// a sidecar exits: the value, if set, otherwise the number of primaries in the
+// topology, or 1.
+func parsePrimaries(value string, topologyPrimaries int) (int, error) {
+	if value == "" {
+		return max(topologyPrimaries, 1), nil
+	}
+	primaries, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse primaries: %v", err)
+	}
+	if primaries < 1 {
+		return 0, fmt.Errorf("invalid primaries: %d: must be positive", primaries)
+	}
+	return primaries, nil
+}
+
+// tombstoneNames returns the tombstone names, comma separated.
+func tombstoneNames(tombstones []*tombstone.Tombstone) string {
+	names := make([]string, 0, len(tombstones))
+	for _, t := range tombstones {
+		names = append(names, t.Name)
+	}
+	return strings.Join(names, ",")
+}
+
 // onDeathOfAny returns an EventHandler that executes the callback when any of
 // the deathDeps processes have died.
-func onDeathOfAny(deathDeps []string, callback func()) tombstone.EventHandler {
+func onDeathOfAny(deathDeps []string, callback func(*tombstone.Tombstone)) tombstone.EventHandler {
 	deathDepSet := map[string]struct{}{}
 	for _, depName := range deathDeps {
 		deathDepSet[depName] = struct{}{}
@@ -348,6 +1378,6 @@ func onDeathOfAny(deathDeps []string, callback func()) tombstone.EventHandler {
 		log.Printf("New death: %s\n", name)
 		log.Printf("Tombstone(%s): %s\n", name, ts)
 
-		callback()
+		callback(ts)
 	}
 }
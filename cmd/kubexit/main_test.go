@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/karlkfi/kubexit/pkg/birth"
+	"github.com/karlkfi/kubexit/pkg/kubernetes"
+	"github.com/karlkfi/kubexit/pkg/tombstone"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testTimeout = 10 * time.Second
+
+// newTestPod returns a pod with an app container, ready or not.
+func newTestPod(ready bool) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", Ready: ready},
+			},
+		},
+	}
+}
+
+// birthTest runs waitForBirthDeps for a birth dep on the app container,
+// against a fake clientset and a temp graveyard.
+type birthTest struct {
+	t        *testing.T
+	watchers chan *watch.FakeWatcher
+	resultCh chan error
+}
+
+func startBirthTest(t *testing.T, timeout, stability time.Duration) *birthTest {
+	bt := &birthTest{
+		t:        t,
+		watchers: make(chan *watch.FakeWatcher, 10),
+		resultCh: make(chan error, 1),
+	}
+
+	clientset := fake.NewSimpleClientset(newTestPod(false))
+	clientset.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewFakeWithChanSize(10, false)
+		bt.watchers <- w
+		return true, w, nil
+	})
+
+	deps, err := birth.ParseDependencies("app")
+	if err != nil {
+		t.Fatalf("failed to parse birth deps: %v", err)
+	}
+	ts := &tombstone.Tombstone{
+		Graveyard: t.TempDir(),
+		Name:      "self",
+	}
+	clients := &kubernetes.Clients{Kube: clientset}
+	go func() {
+		bt.resultCh <- waitForBirthDeps(context.Background(), clients, ts, deps, "ns", "pod", timeout, stability)
+	}()
+	return bt
+}
+
+// nextWatcher returns the next FakeWatcher, or fails the test.
+func (bt *birthTest) nextWatcher() *watch.FakeWatcher {
+	bt.t.Helper()
+	select {
+	case w := <-bt.watchers:
+		return w
+	case <-time.After(testTimeout):
+		bt.t.Fatal("timed out waiting for watch")
+		return nil
+	}
+}
+
+// waitForResult returns the result of waitForBirthDeps, or fails the test.
+func (bt *birthTest) waitForResult() error {
+	bt.t.Helper()
+	select {
+	case err := <-bt.resultCh:
+		return err
+	case <-time.After(testTimeout):
+		bt.t.Fatal("timed out waiting for birth deps")
+		return nil
+	}
+}
+
+// expectNoResult fails the test if waitForBirthDeps returns within the
+// duration.
+func (bt *birthTest) expectNoResult(d time.Duration) {
+	bt.t.Helper()
+	select {
+	case err := <-bt.resultCh:
+		bt.t.Fatalf("expected to still be waiting for birth deps, got: %v", err)
+	case <-time.After(d):
+	}
+}
+
+func TestWaitForBirthDepsReady(t *testing.T) {
+	bt := startBirthTest(t, testTimeout, 0)
+	w := bt.nextWatcher()
+	bt.expectNoResult(100 * time.Millisecond)
+
+	w.Modify(newTestPod(true))
+	if err := bt.waitForResult(); err != nil {
+		t.Fatalf("expected birth deps ready, got: %v", err)
+	}
+}
+
+func TestWaitForBirthDepsTimeout(t *testing.T) {
+	bt := startBirthTest(t, 200*time.Millisecond, 0)
+	bt.nextWatcher()
+
+	err := bt.waitForResult()
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got: %v", err)
+	}
+}
+
+func TestWaitForBirthDepsStabilityReset(t *testing.T) {
+	bt := startBirthTest(t, testTimeout, 300*time.Millisecond)
+	w := bt.nextWatcher()
+
+	// ready, but not for long enough
+	w.Modify(newTestPod(true))
+	bt.expectNoResult(100 * time.Millisecond)
+	w.Modify(newTestPod(false))
+	bt.expectNoResult(400 * time.Millisecond)
+
+	w.Modify(newTestPod(true))
+	if err := bt.waitForResult(); err != nil {
+		t.Fatalf("expected birth deps ready, got: %v", err)
+	}
+}
+
+func TestWithCancelOnSignalParentCanceled(t *testing.T) {
+	// other handlers must keep receiving signals after the context is done
+	otherCh := make(chan os.Signal, 1)
+	signal.Notify(otherCh, syscall.SIGUSR1)
+	defer signal.Stop(otherCh)
+
+	parent, cancelParent := context.WithCancel(context.Background())
+	cancelParent()
+	for i := 0; i < 50; i++ {
+		ctx, stop := withCancelOnSignal(parent, syscall.SIGUSR1)
+		<-ctx.Done()
+		stop()
+	}
+	// give the signal watchers time to stop
+	time.Sleep(100 * time.Millisecond)
+
+	err := syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	if err != nil {
+		t.Fatalf("failed to send signal: %v", err)
+	}
+	select {
+	case <-otherCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for signal")
+	}
+}
+
+func TestWithCancelOnSignal(t *testing.T) {
+	ctx, stop := withCancelOnSignal(context.Background(), syscall.SIGUSR2)
+	defer stop()
+
+	err := syscall.Kill(os.Getpid(), syscall.SIGUSR2)
+	if err != nil {
+		t.Fatalf("failed to send signal: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for cancel")
+	}
+}
+
+func TestParsePrimaries(t *testing.T) {
+	tests := []struct {
+		value             string
+		topologyPrimaries int
+		expected          int
+		wantErr           bool
+	}{
+		{"", 0, 1, false},
+		{"", 3, 3, false},
+		{"2", 3, 2, false},
+		{"0", 0, 0, true},
+		{"x", 0, 0, true},
+	}
+	for _, tt := range tests {
+		primaries, err := parsePrimaries(tt.value, tt.topologyPrimaries)
+		if (err != nil) != tt.wantErr || primaries != tt.expected {
+			t.Errorf("parsePrimaries(%q, %d): expected %d (error: %v), got %d (%v)", tt.value, tt.topologyPrimaries, tt.expected, tt.wantErr, primaries, err)
+		}
+	}
+}
+
+func TestDiscoverNamespace(t *testing.T) {
+	namespace, err := discoverNamespace("explicit", "kubeconfig")
+	if err != nil || namespace != "explicit" {
+		t.Errorf("expected explicit namespace, got %q (%v)", namespace, err)
+	}
+	namespace, err = discoverNamespace("", "kubeconfig")
+	if err != nil || namespace != "kubeconfig" {
+		t.Errorf("expected kubeconfig namespace, got %q (%v)", namespace, err)
+	}
+	if _, statErr := os.Stat(kubernetes.ServiceAccountNamespacePath); statErr == nil {
+		return
+	}
+	_, err = discoverNamespace("", "")
+	if err == nil || !strings.Contains(err.Error(), "set KUBEXIT_NAMESPACE explicitly") {
+		t.Errorf("expected service account namespace error, got: %v", err)
+	}
+}
+
+func TestFindDeadlock(t *testing.T) {
+	graveyard := t.TempDir()
+	waiting := func(name string, waitingFor ...string) *tombstone.Tombstone {
+		ts := &tombstone.Tombstone{Graveyard: graveyard, Name: name}
+		if err := ts.RecordWaiting(waitingFor); err != nil {
+			t.Fatalf("failed to record waiting: %v", err)
+		}
+		return ts
+	}
+
+	// a, b, and c wait for each other
+	waiting("a", "b")
+	waiting("b", "c")
+	waiting("c", "a")
+	// d waited for e and e waited for d, but d died waiting
+	d := waiting("d", "e")
+	waiting("e", "d")
+	if err := d.RecordDeath(1); err != nil {
+		t.Fatalf("failed to record death: %v", err)
+	}
+	// f waits for g, which died with a stale waiting list
+	waiting("f", "g")
+	died := time.Now()
+	code := 1
+	g := &tombstone.Tombstone{Graveyard: graveyard, Name: "g", WaitingFor: []string{"f"}, Died: &died, ExitCode: &code}
+	if err := g.Write(); err != nil {
+		t.Fatalf("failed to write tombstone: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{"a", []string{"a", "b", "c", "a"}},
+		{"c", []string{"c", "a", "b", "c"}},
+		{"e", nil},
+		{"f", nil},
+	}
+	for _, tt := range tests {
+		cycle, err := findDeadlock(graveyard, tt.name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(cycle, tt.expected) {
+			t.Errorf("findDeadlock(%s): expected %q, got %q", tt.name, tt.expected, cycle)
+		}
+	}
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/karlkfi/kubexit/pkg/birth"
+	"github.com/karlkfi/kubexit/pkg/processes"
+	"github.com/karlkfi/kubexit/pkg/supervisor"
+	"github.com/karlkfi/kubexit/pkg/termination"
+	"github.com/karlkfi/kubexit/pkg/tombstone"
+	"github.com/karlkfi/kubexit/pkg/topology"
+	"sigs.k8s.io/yaml"
+)
+
+// process is a child process supervised alongside others in the same
+// container, with its own tombstone and dependencies.
+type process struct {
+	name           string
+	birthDeps      []birth.Dependency
+	birthTimeout   time.Duration
+	birthStability time.Duration
+	deathDeps      []string
+	gracePeriod    time.Duration
+	role           tombstone.Role
+	fateGroup      string
+	// minPrimaries is the minimum number of primaries that must die before
+	// a sidecar exits
+	minPrimaries int
+	// fate is nil without a fate group
+	fate *fate
+	// effective is the spec with defaults applied, for --print-config
+	effective processes.Process
+
+	child *supervisor.Supervisor
+	ts    *tombstone.Tombstone
+	// code is the exit code, set before done is closed
+	code int
+	done chan struct{}
+
+	lock sync.Mutex
+	// stopping is true once shutdown is requested, to skip starting
+	stopping bool
+	// stopWaiting interrupts waiting for birth deps
+	stopWaiting context.CancelFunc
+}
+
+// runProcesses supervises the processes in a spec file and returns the exit
+// code of the primary process. The other processes are gracefully
+// terminated when the primary exits.
+func runProcesses(specPath, graveyard string, printConfig bool) int {
+	log.Printf("Processes: %s\n", specPath)
+	spec, err := processes.Read(specPath)
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		return 2
+	}
+
+	topologyPath := getenv("KUBEXIT_TOPOLOGY")
+	var topologyPrimaries int
+	if topologyPath != "" {
+		log.Printf("Topology: %s\n", topologyPath)
+		topo, err := topology.Read(topologyPath)
+		if err != nil {
+			log.Printf("Error: %v\n", err)
+			return 2
+		}
+		spec.Merge(topo)
+		topologyPrimaries = topo.Primaries()
+	}
+
+	if primary := getenv("KUBEXIT_PRIMARY"); primary != "" {
+		spec.Primary = primary
+	}
+	err = spec.Validate()
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		return 2
+	}
+	log.Printf("Primary: %s\n", spec.Primary)
+	minPrimaries, err := parsePrimaries(getenv("KUBEXIT_PRIMARIES"), topologyPrimaries)
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		return 2
+	}
+	log.Printf("Graveyard: %s\n", graveyard)
+
+	terminationMessagePath := getenv("KUBEXIT_TERMINATION_MESSAGE_PATH")
+	if terminationMessagePath == "" {
+		terminationMessagePath = termination.DefaultPath
+	}
+	var terminationMessageLines int
+	terminationMessageLinesStr := getenv("KUBEXIT_TERMINATION_MESSAGE_LINES")
+	if terminationMessageLinesStr != "" {
+		terminationMessageLines, err = strconv.Atoi(terminationMessageLinesStr)
+		if err != nil {
+			log.Printf("Error: failed to parse termination message lines: %v\n", err)
+			return 2
+		}
+	}
+
+	procs := make(map[string]*process, len(spec.Processes))
+	for _, name := range spec.Names() {
+		proc, err := newProcess(name, spec.Processes[name], graveyard)
+		if err != nil {
+			log.Printf("Error: process %s: %v\n", name, err)
+			return 2
+		}
+		proc.minPrimaries = minPrimaries
+		procs[name] = proc
+	}
+
+	if printConfig {
+		effective := processes.Spec{Primary: spec.Primary, Processes: map[string]processes.Process{}}
+		for name, proc := range procs {
+			effective.Processes[name] = proc.effective
+		}
+		// the container-wide settings are printed as YAML comments, so that
+		// the output is a valid processes file
+		var settings strings.Builder
+		printSettings(&settings, map[string]string{
+			"KUBEXIT_GRAVEYARD":                 graveyard,
+			"KUBEXIT_TOPOLOGY":                  topologyPath,
+			"KUBEXIT_PROCESSES":                 specPath,
+			"KUBEXIT_PRIMARY":                   spec.Primary,
+			"KUBEXIT_PRIMARIES":                 strconv.Itoa(minPrimaries),
+			"KUBEXIT_TERMINATION_MESSAGE_PATH":  terminationMessagePath,
+			"KUBEXIT_TERMINATION_MESSAGE_LINES": strconv.Itoa(terminationMessageLines),
+		})
+		for _, line := range strings.Split(strings.TrimSuffix(settings.String(), "\n"), "\n") {
+			fmt.Printf("# %s\n", line)
+		}
+		out, err := yaml.Marshal(effective)
+		if err != nil {
+			log.Printf("Error: failed to marshal processes: %v\n", err)
+			return 1
+		}
+		fmt.Print(string(out))
+		return 0
+	}
+
+	primary := procs[spec.Primary]
+	primary.child.TailOutput(terminationMessageLines)
+	term := termination.New(terminationMessagePath)
+
+	// Write every tombstone before starting anything, so that stale
+	// tombstones from a previous run of the container don't satisfy
+	// birth deps.
+	for _, name := range spec.Names() {
+		err = procs[name].ts.Write()
+		if err != nil {
+			log.Printf("Error: failed to create tombstone: %v\n", err)
+			return 1
+		}
+	}
+
+	// Cancel birth deps waiting on SIGTERM to trigger graceful exit.
+	// Started child processes receive signals from their supervisors.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	for _, name := range spec.Names() {
+		go procs[name].run(ctx)
+	}
+
+	<-primary.done
+	log.Printf("Primary process %s exited(%d): shutting down other processes...\n", primary.name, primary.code)
+	term.SetReason("primary process %s exited %d", primary.name, primary.code)
+	for _, name := range spec.Names() {
+		procs[name].shutdown()
+	}
+	for _, name := range spec.Names() {
+		<-procs[name].done
+	}
+
+	writeTerminationMessage(term, primary.code, primary.child)
+	return primary.code
+}
+
+// newProcess returns a process from its spec, with durations parsed and
+// defaults applied.
+func newProcess(name string, spec processes.Process, graveyard string) (*process, error) {
+	p := &process{
+		name:         name,
+		deathDeps:    spec.DeathDeps,
+		fateGroup:    spec.FateGroup,
+		birthTimeout: 30 * time.Second,
+		gracePeriod:  30 * time.Second,
+		done:         make(chan struct{}),
+	}
+
+	var err error
+	if len(spec.BirthDeps) > 0 {
+		p.birthDeps, err = birth.ParseDependencies(strings.Join(spec.BirthDeps, ","))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse birth deps: %v", err)
+		}
+	}
+	if spec.BirthTimeout != "" {
+		p.birthTimeout, err = time.ParseDuration(spec.BirthTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse birth timeout: %v", err)
+		}
+	}
+	if spec.BirthStability != "" {
+		p.birthStability, err = time.ParseDuration(spec.BirthStability)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse birth stability: %v", err)
+		}
+		if p.birthStability < 0 {
+			return nil, fmt.Errorf("invalid birth stability: %s: must not be negative", p.birthStability)
+		}
+	}
+	if spec.GracePeriod != "" {
+		p.gracePeriod, err = time.ParseDuration(spec.GracePeriod)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse grace period: %v", err)
+		}
+	}
+	p.role, err = tombstone.ParseRole(spec.Role)
+	if err != nil {
+		return nil, err
+	}
+	if p.fateGroup != "" {
+		p.fate = &fate{}
+	}
+	restartPolicy, err := newRestartPolicy(spec.RestartPolicy, spec.MaxRestarts, spec.RestartBackoff, spec.MaxRestartBackoff)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Process %s: %s (birth deps: %s, death deps: %s, grace period: %s, role: %s, fate group: %s, restart policy: %s)\n",
+		name, strings.Join(spec.Command, " "), orNA(joinDeps(p.birthDeps)), orNA(strings.Join(p.deathDeps, ",")), p.gracePeriod, orNA(string(p.role)), orNA(p.fateGroup), formatRestartPolicy(restartPolicy))
+
+	p.ts = &tombstone.Tombstone{
+		Graveyard:   graveyard,
+		Name:        name,
+		DeathDeps:   p.deathDeps,
+		GracePeriod: p.gracePeriod.String(),
+		Role:        p.role,
+		FateGroup:   p.fateGroup,
+	}
+	if len(p.birthDeps) > 0 {
+		p.ts.BirthDeps = spec.BirthDeps
+		p.ts.BirthTimeout = p.birthTimeout.String()
+		p.ts.BirthStability = p.birthStability.String()
+	}
+
+	p.effective = spec
+	p.effective.BirthDeps = nil
+	for _, dep := range p.birthDeps {
+		p.effective.BirthDeps = append(p.effective.BirthDeps, dep.String())
+	}
+	p.effective.BirthTimeout = p.birthTimeout.String()
+	p.effective.BirthStability = p.birthStability.String()
+	p.effective.GracePeriod = p.gracePeriod.String()
+	p.effective.Role = string(p.role)
+	p.effective.RestartPolicy = string(restartPolicy.Restart)
+	p.effective.MaxRestarts = restartPolicy.MaxRestarts
+	p.effective.RestartBackoff = restartPolicy.Backoff.String()
+	p.effective.MaxRestartBackoff = restartPolicy.MaxBackoff.String()
+
+	p.child = supervisor.New(spec.Command[0], spec.Command[1:]...)
+	p.child.PrefixOutput(name + " | ")
+	p.child.SetRestartPolicy(restartPolicy)
+	// nil recorder records nothing
+	p.child.OnRestart(onRestart(p.ts, nil, nil))
+	return p, nil
+}
+
+// run waits for the birth deps, starts the child process, and records its
+// birth and death. Closes done when the process has exited or failed to
+// start.
+func (p *process) run(ctx context.Context) {
+	defer close(p.done)
+
+	if len(p.deathDeps) > 0 {
+		watchCtx, stopGraveyardWatcher := context.WithCancel(ctx)
+		defer stopGraveyardWatcher()
+
+		err := tombstone.Watch(watchCtx, p.ts.Graveyard, onDeathOfAny(p.deathDeps, func(dead *tombstone.Tombstone) {
+			stopGraveyardWatcher()
+			log.Printf("Process %s: death dependency %s exited(%d)\n", p.name, dead.Name, exitCodeOf(dead))
+			p.shutdown()
+		}))
+		if err != nil {
+			p.fail("failed to watch graveyard: %v", err)
+			return
+		}
+	}
+
+	if p.fateGroup != "" {
+		watchCtx, stopFateWatcher := context.WithCancel(ctx)
+		defer stopFateWatcher()
+
+		onFailure := func(origin string, code int) {
+			if !p.fate.fail(origin, code) {
+				return
+			}
+			stopFateWatcher()
+			log.Printf("Process %s: fate group %s member %s exited(%d)\n", p.name, p.fateGroup, origin, code)
+			p.shutdown()
+		}
+		err := tombstone.Watch(watchCtx, p.ts.Graveyard, onFateGroupFailure(p.name, p.fateGroup, onFailure))
+		if err != nil {
+			p.fail("failed to watch graveyard: %v", err)
+			return
+		}
+		// another member may have failed before the graveyard was watched
+		checkFateGroupFailed(p.ts.Graveyard, p.name, p.fateGroup, onFailure)
+	}
+
+	var onPrimariesDied func([]*tombstone.Tombstone)
+	if p.role == tombstone.RoleSidecar {
+		watchCtx, stopPrimariesWatcher := context.WithCancel(ctx)
+		defer stopPrimariesWatcher()
+
+		var once sync.Once
+		onPrimariesDied = func(primaries []*tombstone.Tombstone) {
+			once.Do(func() {
+				stopPrimariesWatcher()
+				log.Printf("Process %s: all primary processes exited: %s\n", p.name, tombstoneNames(primaries))
+				p.shutdown()
+			})
+		}
+		err := tombstone.Watch(watchCtx, p.ts.Graveyard, onDeathOfPrimaries(p.name, p.minPrimaries, onPrimariesDied))
+		if err != nil {
+			p.fail("failed to watch graveyard: %v", err)
+			return
+		}
+	}
+
+	if len(p.birthDeps) > 0 {
+		err := p.waitForBirthDeps(ctx)
+		if err != nil {
+			p.fail("%v", err)
+			return
+		}
+	}
+
+	started, err := p.start()
+	if err != nil {
+		p.fail("%v", err)
+		return
+	}
+	if !started {
+		log.Printf("Process %s: shut down before start\n", p.name)
+		p.recordDeath(0)
+		return
+	}
+
+	err = p.ts.RecordBirth()
+	if err != nil {
+		log.Printf("Error: process %s: %v\n", p.name, err)
+	}
+
+	// every primary may have died before the child started
+	if onPrimariesDied != nil {
+		checkPrimariesDied(p.ts.Graveyard, p.minPrimaries, onPrimariesDied)
+	}
+
+	p.recordDeath(waitForChildExit(p.child))
+}
+
+// start starts the child process, unless shutdown was already requested.
+func (p *process) start() (bool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.stopping {
+		return false, nil
+	}
+	err := p.child.Start()
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// shutdown gracefully terminates the child process, if started, or stops it
+// from starting, if not. Safe to call more than once.
+func (p *process) shutdown() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.stopping {
+		return
+	}
+	p.stopping = true
+	if p.stopWaiting != nil {
+		p.stopWaiting()
+	}
+	// Skipped if not started or already exited.
+	err := p.child.ShutdownWithTimeout(p.gracePeriod)
+	// ShutdownWithTimeout doesn't block until timeout
+	if err != nil {
+		log.Printf("Error: process %s: failed to shutdown: %v\n", p.name, err)
+	}
+}
+
+// fail records the death of a process that failed before its child process
+// started. Like a single process, it exits 1.
+func (p *process) fail(msg string, args ...interface{}) {
+	log.Printf("Error: process %s: %s\n", p.name, fmt.Sprintf(msg, args...))
+	p.recordDeath(1)
+}
+
+// recordDeath records the exit code, or the propagated exit code of a failed
+// fate group member.
+func (p *process) recordDeath(code int) {
+	var err error
+	p.code, err = p.fate.recordDeath(p.ts, code)
+	if err != nil {
+		log.Printf("Error: process %s: %v\n", p.name, err)
+	}
+}
+
+// waitForBirthDeps blocks until the other processes that this process
+// depends on are born (or have exited, depending on the condition), or
+// until the birth timeout, a SIGTERM, or a shutdown request.
+func (p *process) waitForBirthDeps(ctx context.Context) error {
+	ctx, stopWatchers := context.WithTimeout(ctx, p.birthTimeout)
+	defer stopWatchers()
+
+	p.lock.Lock()
+	if p.stopping {
+		p.lock.Unlock()
+		return nil
+	}
+	p.stopWaiting = stopWatchers
+	p.lock.Unlock()
+
+	// Closed by the tracker when all birth deps are ready.
+	readyCh := make(chan struct{})
+	tracker := birth.NewTracker(p.birthDeps, p.birthStability, func() {
+		close(readyCh)
+	})
+
+	update := func(ts *tombstone.Tombstone) {
+		for _, dep := range p.birthDeps {
+			if dep.Name == ts.Name {
+				tracker.Update(dep, metByTombstone(dep, ts))
+			}
+		}
+	}
+
+	log.Printf("Process %s: watching graveyard for birth deps: %s\n", p.name, joinDeps(p.birthDeps))
+	err := tombstone.Watch(ctx, p.ts.Graveyard, func(event fsnotify.Event) {
+		if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+			return
+		}
+		ts, err := tombstone.Read(filepath.Dir(event.Name), filepath.Base(event.Name))
+		if err != nil {
+			// may be partially written
+			return
+		}
+		update(ts)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch graveyard: %v", err)
+	}
+
+	// deps may have been born before the watch started
+	for _, dep := range p.birthDeps {
+		ts, err := tombstone.Read(p.ts.Graveyard, dep.Name)
+		if err == nil {
+			update(ts)
+		}
+	}
+
+	select {
+	case <-readyCh:
+		log.Printf("Process %s: all birth deps ready: %v\n", p.name, joinDeps(p.birthDeps))
+		return nil
+	case <-ctx.Done():
+		p.lock.Lock()
+		stopping := p.stopping
+		p.lock.Unlock()
+		if stopping {
+			// start is skipped
+			return nil
+		}
+		err := ctx.Err()
+		if err == context.DeadlineExceeded {
+			return fmt.Errorf("timed out waiting for birth deps to be ready: %s", p.birthTimeout)
+		}
+		return fmt.Errorf("interrupted waiting for birth deps to be ready: %v", err)
+	}
+}
+
+// metByTombstone returns true if the tombstone of another process in the
+// same container satisfies the dependency condition. Processes have no
+// probes, so ready is the same as started.
+func metByTombstone(dep birth.Dependency, ts *tombstone.Tombstone) bool {
+	switch dep.Condition {
+	case birth.ConditionCompleted:
+		return ts.Died != nil
+	case birth.ConditionSucceeded:
+		return ts.Died != nil && ts.ExitCode != nil && *ts.ExitCode == 0
+	default:
+		return ts.Born != nil
+	}
+}
+
+// orNA returns the value, or N/A if empty.
+func orNA(value string) string {
+	if value == "" {
+		return "N/A"
+	}
+	return value
+}
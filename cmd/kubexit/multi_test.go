@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/karlkfi/kubexit/pkg/birth"
+	"github.com/karlkfi/kubexit/pkg/processes"
+	"github.com/karlkfi/kubexit/pkg/tombstone"
+	"github.com/karlkfi/kubexit/pkg/topology"
+)
+
+func TestMetByTombstone(t *testing.T) {
+	graveyard := t.TempDir()
+
+	started := &tombstone.Tombstone{Graveyard: graveyard, Name: "started"}
+	if err := started.RecordBirth(); err != nil {
+		t.Fatalf("failed to record birth: %v", err)
+	}
+	succeeded := &tombstone.Tombstone{Graveyard: graveyard, Name: "succeeded"}
+	if err := succeeded.RecordBirth(); err != nil {
+		t.Fatalf("failed to record birth: %v", err)
+	}
+	if err := succeeded.RecordDeath(0); err != nil {
+		t.Fatalf("failed to record death: %v", err)
+	}
+	failed := &tombstone.Tombstone{Graveyard: graveyard, Name: "failed"}
+	if err := failed.RecordBirth(); err != nil {
+		t.Fatalf("failed to record birth: %v", err)
+	}
+	if err := failed.RecordDeath(1); err != nil {
+		t.Fatalf("failed to record death: %v", err)
+	}
+	waiting := &tombstone.Tombstone{Graveyard: graveyard, Name: "waiting"}
+	if err := waiting.RecordWaiting([]string{"started"}); err != nil {
+		t.Fatalf("failed to record waiting: %v", err)
+	}
+
+	tests := []struct {
+		dep      string
+		expected bool
+	}{
+		{"started", true},
+		{"started:ready", true},
+		{"started:started", true},
+		{"started:completed", false},
+		{"started:succeeded", false},
+		{"waiting", false},
+		{"waiting:started", false},
+		{"succeeded:completed", true},
+		{"succeeded:succeeded", true},
+		{"failed:completed", true},
+		{"failed:succeeded", false},
+	}
+	for _, tt := range tests {
+		dep, err := birth.ParseDependency(tt.dep)
+		if err != nil {
+			t.Fatalf("failed to parse birth dep: %v", err)
+		}
+		ts, err := tombstone.Read(graveyard, dep.Name)
+		if err != nil {
+			t.Fatalf("failed to read tombstone: %v", err)
+		}
+		if met := metByTombstone(dep, ts); met != tt.expected {
+			t.Errorf("metByTombstone(%s): expected %v, got %v", tt.dep, tt.expected, met)
+		}
+	}
+}
+
+// TestProcessFateGroupFailedBeforeWatch checks that a member that failed
+// before the graveyard was watched stops the process from starting.
+func TestProcessFateGroupFailedBeforeWatch(t *testing.T) {
+	graveyard := t.TempDir()
+	failed := &tombstone.Tombstone{Graveyard: graveyard, Name: "failed", FateGroup: "group"}
+	if err := failed.RecordBirth(); err != nil {
+		t.Fatalf("failed to record birth: %v", err)
+	}
+	if err := failed.RecordDeath(3); err != nil {
+		t.Fatalf("failed to record death: %v", err)
+	}
+
+	spec := processes.Process{
+		Process: topology.Process{FateGroup: "group"},
+		Command: []string{"sleep", "30"},
+	}
+	p, err := newProcess("app", spec, graveyard)
+	if err != nil {
+		t.Fatalf("failed to create process: %v", err)
+	}
+	go p.run(context.Background())
+
+	select {
+	case <-p.done:
+	case <-time.After(testTimeout):
+		p.shutdown()
+		t.Fatal("timed out waiting for process to skip starting")
+	}
+	if p.code != 3 {
+		t.Errorf("expected propagated exit code 3, got %d", p.code)
+	}
+	ts, err := tombstone.Read(graveyard, "app")
+	if err != nil {
+		t.Fatalf("failed to read tombstone: %v", err)
+	}
+	if ts.Born != nil || ts.FailedBy != "failed" {
+		t.Errorf("expected unborn tombstone failed by failed, got: %+v", ts)
+	}
+}
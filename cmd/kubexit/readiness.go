@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/karlkfi/kubexit/pkg/kubernetes"
+	"github.com/karlkfi/kubexit/pkg/supervisor"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// readiness sets the readiness gate pod condition in the background.
+// Updates are applied in order by a single goroutine, which skips to the
+// latest pending update, so that a slow update can't overwrite a later one.
+// Once shut, the condition is never set back to True.
+// A nil readiness does nothing, so that it can be used without checks.
+type readiness struct {
+	clients   *kubernetes.Clients
+	namespace string
+	podName   string
+	condition corev1.PodConditionType
+
+	lock     sync.Mutex
+	idle     *sync.Cond
+	pending  *readinessUpdate
+	applying bool
+	shut     bool
+	wakeCh   chan struct{}
+}
+
+type readinessUpdate struct {
+	status  corev1.ConditionStatus
+	reason  string
+	message string
+}
+
+func newReadiness(clients *kubernetes.Clients, namespace, podName, condition string) *readiness {
+	g := &readiness{
+		clients:   clients,
+		namespace: namespace,
+		podName:   podName,
+		condition: corev1.PodConditionType(condition),
+		wakeCh:    make(chan struct{}, 1),
+	}
+	g.idle = sync.NewCond(&g.lock)
+	go g.run()
+	return g
+}
+
+// set queues an update of the condition, replacing any pending update.
+// Updates to True are ignored once the gate is shut.
+func (g *readiness) set(status corev1.ConditionStatus, reason, message string) {
+	if g == nil {
+		return
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.queue(status, reason, message)
+}
+
+// shutdown queues an update of the condition to False, and ignores any later
+// updates to True.
+func (g *readiness) shutdown(reason, message string) {
+	if g == nil {
+		return
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.shut = true
+	g.queue(corev1.ConditionFalse, reason, message)
+}
+
+func (g *readiness) queue(status corev1.ConditionStatus, reason, message string) {
+	if g.shut && status == corev1.ConditionTrue {
+		return
+	}
+	g.pending = &readinessUpdate{status: status, reason: reason, message: message}
+	select {
+	case g.wakeCh <- struct{}{}:
+	default:
+		// already woken
+	}
+}
+
+// wait blocks until all queued updates are applied.
+func (g *readiness) wait() {
+	if g == nil {
+		return
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for g.pending != nil || g.applying {
+		g.idle.Wait()
+	}
+}
+
+func (g *readiness) run() {
+	for range g.wakeCh {
+		g.lock.Lock()
+		update := g.pending
+		g.pending = nil
+		g.applying = update != nil
+		g.lock.Unlock()
+
+		if update != nil {
+			g.apply(update)
+		}
+
+		g.lock.Lock()
+		g.applying = false
+		if g.pending == nil {
+			g.idle.Broadcast()
+		}
+		g.lock.Unlock()
+	}
+}
+
+// apply sets the readiness gate pod condition, logging any error.
+func (g *readiness) apply(update *readinessUpdate) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := kubernetes.SetPodCondition(ctx, g.clients.Kube, g.namespace, g.podName, g.condition, update.status, update.reason, update.message)
+	if err != nil {
+		log.Printf("Error: failed to set readiness gate: %v\n", err)
+		return
+	}
+	log.Printf("Readiness Gate: %s=%s\n", g.condition, update.status)
+}
+
+// onShutdownReadinessGate returns a ShutdownHook that sets the readiness gate
+// condition to False, so that Services stop routing to the pod as soon as
+// shutdown begins, instead of waiting for probes to fail.
+// The condition is set asyncronously, so that shutdown isn't delayed.
+func onShutdownReadinessGate(gate *readiness) supervisor.ShutdownHook {
+	var once sync.Once
+	return func(sig os.Signal) {
+		once.Do(func() {
+			gate.shutdown("ShuttingDown", fmt.Sprintf("Child process sent %v", sig))
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/karlkfi/kubexit/pkg/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestReadinessShutdownWins(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"},
+	})
+	// slow down the first update, so that later updates are queued behind it
+	patches := 0
+	clientset.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patches++
+		if patches == 1 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return false, nil, nil
+	})
+
+	gate := newReadiness(&kubernetes.Clients{Kube: clientset}, "ns", "pod", "example.com/ready")
+	gate.set(corev1.ConditionTrue, "Started", "Child process started")
+	time.Sleep(10 * time.Millisecond)
+	gate.shutdown("ShuttingDown", "Child process sent terminated")
+	gate.set(corev1.ConditionTrue, "Started", "Child process started")
+	gate.wait()
+
+	pod, err := clientset.CoreV1().Pods("ns").Get(context.Background(), "pod", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get pod: %v", err)
+	}
+	if len(pod.Status.Conditions) != 1 {
+		t.Fatalf("expected 1 condition, got %d", len(pod.Status.Conditions))
+	}
+	cond := pod.Status.Conditions[0]
+	if cond.Status != corev1.ConditionFalse || cond.Reason != "ShuttingDown" {
+		t.Errorf("expected False (ShuttingDown), got %s (%s)", cond.Status, cond.Reason)
+	}
+	if patches != 2 {
+		t.Errorf("expected 2 patches, got %d", patches)
+	}
+}
+
+func TestReadinessNil(t *testing.T) {
+	var gate *readiness
+	gate.set(corev1.ConditionTrue, "Started", "Child process started")
+	gate.shutdown("Exited", "Child process exited(0)")
+	gate.wait()
+}
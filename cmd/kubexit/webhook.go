@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/karlkfi/kubexit/pkg/inject"
+	"github.com/karlkfi/kubexit/pkg/webhook"
+)
+
+// runWebhook implements `kubexit webhook`, which serves a mutating admission
+// webhook that injects kubexit into pods with deps annotations.
+func runWebhook(args []string) int {
+	fs := flag.NewFlagSet("kubexit webhook", flag.ContinueOnError)
+	listen := fs.String("listen", ":8443", "Address to serve on.")
+	certFile := fs.String("tls-cert-file", "/etc/kubexit/tls/tls.crt", "Path of the TLS certificate. Reloaded when changed.")
+	keyFile := fs.String("tls-key-file", "/etc/kubexit/tls/tls.key", "Path of the TLS private key. Reloaded when changed.")
+	image := fs.String("image", inject.DefaultImage, "Image to copy the kubexit binary from.")
+	graveyard := fs.String("graveyard", inject.DefaultGraveyard, "Mount path of the graveyard volume.")
+	binDir := fs.String("bin-dir", inject.DefaultBinDir, "Mount path of the volume the kubexit binary is copied into.")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: kubexit webhook [flags]")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Serves a mutating admission webhook (AdmissionReview v1) at /mutate that injects")
+		fmt.Fprintln(out, "kubexit into pods with kubexit.io/deps.<container> annotations.")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Flags:")
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+
+	// remove log timestamp
+	log.SetFlags(log.Flags() &^ (log.Ldate | log.Ltime))
+
+	cfg := inject.Config{
+		Image:     *image,
+		Graveyard: *graveyard,
+		BinDir:    *binDir,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err = webhook.Serve(ctx, *listen, *certFile, *keyFile, webhook.Handler(cfg))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
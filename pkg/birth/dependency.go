@@ -0,0 +1,324 @@
+package birth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Kind is the type of object a birth dependency refers to.
+type Kind string
+
+const (
+	// KindContainer is a sibling container in the same pod.
+	KindContainer Kind = "container"
+	// KindService is a Service in the same namespace, with ready endpoints.
+	KindService Kind = "service"
+	// KindPods is a set of pods in the same namespace, selected by labels.
+	KindPods Kind = "pods"
+	// KindObject is an arbitrary Kubernetes object, with a status condition.
+	KindObject Kind = "object"
+)
+
+// Condition is the state a birth dependency container must reach before the
+// dependent process is started.
+type Condition string
+
+const (
+	// ConditionReady requires the container to be passing its readiness probe.
+	ConditionReady Condition = "ready"
+	// ConditionStarted requires the container to be started. Useful for
+	// containers without probes.
+	ConditionStarted Condition = "started"
+	// ConditionCompleted requires the container to be terminated, with any
+	// exit code.
+	ConditionCompleted Condition = "completed"
+	// ConditionSucceeded requires the container to be terminated with exit
+	// code 0.
+	ConditionSucceeded Condition = "succeeded"
+)
+
+// Dependency is a birth dependency on a sibling container in the same pod,
+// on another workload in the same namespace, or on an arbitrary object.
+type Dependency struct {
+	Kind Kind
+	// Name of the container, service, or object.
+	Name string
+	// Condition of the container. Only used by KindContainer.
+	Condition Condition
+	// Selector of the pods. Only used by KindPods.
+	Selector labels.Selector
+	// MinReady is the minimum number of ready endpoints or pods.
+	// Only used by KindService and KindPods.
+	MinReady int
+	// GVK is the group, version, and kind of the object.
+	// Only used by KindObject.
+	GVK schema.GroupVersionKind
+	// Namespace of the object. Empty for cluster-scoped objects or to use the
+	// pod namespace. Only used by KindObject.
+	Namespace string
+	// ConditionType and ConditionStatus of the object status condition.
+	// Only used by KindObject.
+	ConditionType   string
+	ConditionStatus string
+}
+
+// ParseDependency parses a birth dependency of one of the following forms:
+//
+//   - `<container>[:<condition>]` - sibling container, default condition: ready
+//   - `service/<name>[:<min-ready>]` - service endpoints, default min-ready: 1
+//   - `pods/<selector>[:<min-ready>]` - selected pods, default min-ready: 1
+//   - `<group>/<version>/<kind>/<namespace>/<name>#<type>[=<status>]` - object
+//     status condition, default status: True
+//
+// Pod selector requirements are separated by `&` instead of `,`, because
+// commas separate dependencies.
+func ParseDependency(s string) (Dependency, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.Contains(s, "#"):
+		return parseObjectDependency(s)
+	case strings.HasPrefix(s, "service/"):
+		return parseServiceDependency(s)
+	case strings.HasPrefix(s, "pods/"):
+		return parsePodsDependency(s)
+	default:
+		return parseContainerDependency(s)
+	}
+}
+
+func parseContainerDependency(s string) (Dependency, error) {
+	name, cond, found := strings.Cut(s, ":")
+	if name == "" {
+		return Dependency{}, fmt.Errorf("invalid birth dependency %q: missing name", s)
+	}
+	if strings.Contains(name, "/") {
+		// container names can't contain slashes, so this is probably an
+		// object without a condition
+		return Dependency{}, fmt.Errorf("invalid birth dependency %q: expected <container>, service/<name>, pods/<selector>, or <group>/<version>/<kind>/<namespace>/<name>#<condition>", s)
+	}
+	if !found {
+		return Dependency{Kind: KindContainer, Name: name, Condition: ConditionReady}, nil
+	}
+
+	switch c := Condition(strings.ToLower(cond)); c {
+	case ConditionReady, ConditionStarted, ConditionCompleted, ConditionSucceeded:
+		return Dependency{Kind: KindContainer, Name: name, Condition: c}, nil
+	default:
+		return Dependency{}, fmt.Errorf("invalid birth dependency %q: unknown condition: %q", s, cond)
+	}
+}
+
+func parseServiceDependency(s string) (Dependency, error) {
+	name, minReady, err := parseMinReady(strings.TrimPrefix(s, "service/"))
+	if err != nil {
+		return Dependency{}, fmt.Errorf("invalid birth dependency %q: %v", s, err)
+	}
+	if name == "" {
+		return Dependency{}, fmt.Errorf("invalid birth dependency %q: missing service name", s)
+	}
+	return Dependency{Kind: KindService, Name: name, MinReady: minReady}, nil
+}
+
+func parsePodsDependency(s string) (Dependency, error) {
+	selectorStr, minReady, err := parseMinReady(strings.TrimPrefix(s, "pods/"))
+	if err != nil {
+		return Dependency{}, fmt.Errorf("invalid birth dependency %q: %v", s, err)
+	}
+	if selectorStr == "" {
+		return Dependency{}, fmt.Errorf("invalid birth dependency %q: missing pod selector", s)
+	}
+	selector, err := labels.Parse(strings.ReplaceAll(selectorStr, "&", ","))
+	if err != nil {
+		return Dependency{}, fmt.Errorf("invalid birth dependency %q: invalid pod selector: %v", s, err)
+	}
+	return Dependency{Kind: KindPods, Selector: selector, MinReady: minReady}, nil
+}
+
+func parseObjectDependency(s string) (Dependency, error) {
+	path, cond, _ := strings.Cut(s, "#")
+	parts := strings.Split(path, "/")
+	if len(parts) != 5 {
+		return Dependency{}, fmt.Errorf("invalid birth dependency %q: expected <group>/<version>/<kind>/<namespace>/<name>#<condition>", s)
+	}
+	if parts[1] == "" || parts[2] == "" || parts[4] == "" {
+		return Dependency{}, fmt.Errorf("invalid birth dependency %q: missing version, kind, or name", s)
+	}
+	condType, condStatus, found := strings.Cut(cond, "=")
+	if condType == "" {
+		return Dependency{}, fmt.Errorf("invalid birth dependency %q: missing condition type", s)
+	}
+	if !found {
+		condStatus = string(metav1.ConditionTrue)
+	}
+	return Dependency{
+		Kind: KindObject,
+		GVK: schema.GroupVersionKind{
+			Group:   parts[0],
+			Version: parts[1],
+			Kind:    parts[2],
+		},
+		Namespace:       parts[3],
+		Name:            parts[4],
+		ConditionType:   condType,
+		ConditionStatus: condStatus,
+	}, nil
+}
+
+// parseMinReady splits an optional `:<min-ready>` suffix from the input.
+func parseMinReady(s string) (string, int, error) {
+	idx := strings.LastIndex(s, ":")
+	if idx < 0 {
+		return s, 1, nil
+	}
+	minReady, err := strconv.Atoi(s[idx+1:])
+	if err != nil || minReady < 1 {
+		return "", 0, fmt.Errorf("invalid min ready count: %q", s[idx+1:])
+	}
+	return s[:idx], minReady, nil
+}
+
+// ParseDependencies parses a comma separated list of birth dependencies.
+func ParseDependencies(s string) ([]Dependency, error) {
+	var deps []Dependency
+	for _, depStr := range strings.Split(s, ",") {
+		dep, err := ParseDependency(depStr)
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+// MetBy returns true if the dependency container status satisfies the
+// dependency condition.
+func (d Dependency) MetBy(status corev1.ContainerStatus) bool {
+	switch d.Condition {
+	case ConditionStarted:
+		// A container that terminated has started, even though the kubelet
+		// reports Started=false once it has exited.
+		if status.State.Terminated != nil || status.LastTerminationState.Terminated != nil {
+			return true
+		}
+		// Started is false until the startup probe passes, so only fall back
+		// to the state if the kubelet didn't report it.
+		if status.Started != nil {
+			return *status.Started
+		}
+		return status.State.Running != nil || status.State.Terminated != nil
+	case ConditionCompleted:
+		return status.State.Terminated != nil
+	case ConditionSucceeded:
+		return status.State.Terminated != nil && status.State.Terminated.ExitCode == 0
+	default:
+		return status.Ready
+	}
+}
+
+// Met returns true if the dependency is satisfied by the pod status.
+// Returns false if the dependency container is not found.
+func (d Dependency) Met(pod *corev1.Pod) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == d.Name {
+			return d.MetBy(status)
+		}
+	}
+	return false
+}
+
+// MetByEndpointSlices returns true if the service endpoint slices have at
+// least MinReady ready endpoints.
+// Dual-stack services have a slice per address family, with an endpoint for
+// each pod in both, so endpoints are counted once per target pod. Endpoints
+// without a target are counted per address family, using the largest count.
+func (d Dependency) MetByEndpointSlices(slices []*discoveryv1.EndpointSlice) bool {
+	targets := map[string]bool{}
+	untargeted := map[discoveryv1.AddressType]int{}
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			// nil should be interpreted as ready
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			if ref := endpoint.TargetRef; ref != nil {
+				targets[ref.Kind+"/"+ref.Namespace+"/"+ref.Name] = true
+				continue
+			}
+			untargeted[slice.AddressType]++
+		}
+	}
+	ready := 0
+	for _, count := range untargeted {
+		ready = max(ready, count)
+	}
+	return len(targets)+ready >= d.MinReady
+}
+
+// MetByPods returns true if at least MinReady of the selected pods are ready.
+func (d Dependency) MetByPods(pods []*corev1.Pod) bool {
+	ready := 0
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == corev1.PodReady && cond.Status == corev1.ConditionTrue {
+				ready++
+				break
+			}
+		}
+	}
+	return ready >= d.MinReady
+}
+
+// MetByObject returns true if the object has a status condition with the
+// dependency condition type and status.
+func (d Dependency) MetByObject(obj *unstructured.Unstructured) bool {
+	conditions, found, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil || !found {
+		return false
+	}
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if cond["type"] == d.ConditionType {
+			return strings.EqualFold(fmt.Sprint(cond["status"]), d.ConditionStatus)
+		}
+	}
+	return false
+}
+
+// String returns the dependency in the same form it was parsed from.
+func (d Dependency) String() string {
+	switch d.Kind {
+	case KindService:
+		return fmt.Sprintf("service/%s%s", d.Name, minReadySuffix(d.MinReady))
+	case KindPods:
+		selector := strings.ReplaceAll(d.Selector.String(), ",", "&")
+		return fmt.Sprintf("pods/%s%s", selector, minReadySuffix(d.MinReady))
+	case KindObject:
+		return fmt.Sprintf("%s/%s/%s/%s/%s#%s=%s", d.GVK.Group, d.GVK.Version, d.GVK.Kind,
+			d.Namespace, d.Name, d.ConditionType, d.ConditionStatus)
+	}
+	if d.Condition == "" || d.Condition == ConditionReady {
+		return d.Name
+	}
+	return fmt.Sprintf("%s:%s", d.Name, d.Condition)
+}
+
+func minReadySuffix(minReady int) string {
+	if minReady <= 1 {
+		return ""
+	}
+	return fmt.Sprintf(":%d", minReady)
+}
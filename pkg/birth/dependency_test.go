@@ -0,0 +1,316 @@
+package birth_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/karlkfi/kubexit/pkg/birth"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestMetBy(t *testing.T) {
+	started := true
+	notStarted := false
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	succeeded := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}
+	failed := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}}
+
+	tests := []struct {
+		name   string
+		dep    string
+		status corev1.ContainerStatus
+		met    bool
+	}{
+		{"ready", "app", corev1.ContainerStatus{Ready: true, State: running}, true},
+		{"not ready", "app", corev1.ContainerStatus{State: running}, false},
+		{"started", "app:started", corev1.ContainerStatus{Started: &started, State: running}, true},
+		{"running before startup probe passed", "app:started", corev1.ContainerStatus{Started: &notStarted, State: running}, false},
+		{"running without started", "app:started", corev1.ContainerStatus{State: running}, true},
+		{"waiting without started", "app:started", corev1.ContainerStatus{}, false},
+		{"terminated after starting", "app:started", corev1.ContainerStatus{Started: &notStarted, State: succeeded}, true},
+		{"restarting after terminating", "app:started", corev1.ContainerStatus{Started: &notStarted, LastTerminationState: failed}, true},
+		{"completed", "app:completed", corev1.ContainerStatus{State: failed}, true},
+		{"not completed", "app:completed", corev1.ContainerStatus{State: running}, false},
+		{"succeeded", "app:succeeded", corev1.ContainerStatus{State: succeeded}, true},
+		{"failed", "app:succeeded", corev1.ContainerStatus{State: failed}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dep, err := birth.ParseDependency(tc.dep)
+			if err != nil {
+				t.Fatalf("failed to parse birth dep: %v", err)
+			}
+			if met := dep.MetBy(tc.status); met != tc.met {
+				t.Errorf("expected met=%v, got %v", tc.met, met)
+			}
+		})
+	}
+}
+
+func TestParseObjectDependency(t *testing.T) {
+	tests := []struct {
+		name     string
+		dep      string
+		expected birth.Dependency
+		err      string
+	}{
+		{
+			name: "namespaced",
+			dep:  "apps/v1/Deployment/ns/web#Available",
+			expected: birth.Dependency{
+				Kind:            birth.KindObject,
+				GVK:             schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+				Namespace:       "ns",
+				Name:            "web",
+				ConditionType:   "Available",
+				ConditionStatus: "True",
+			},
+		},
+		{
+			name: "core group",
+			dep:  "/v1/PersistentVolumeClaim/ns/data#Resizing",
+			expected: birth.Dependency{
+				Kind:            birth.KindObject,
+				GVK:             schema.GroupVersionKind{Version: "v1", Kind: "PersistentVolumeClaim"},
+				Namespace:       "ns",
+				Name:            "data",
+				ConditionType:   "Resizing",
+				ConditionStatus: "True",
+			},
+		},
+		{
+			name: "cluster-scoped or pod namespace",
+			dep:  "example.com/v1/Widget//widget#Ready",
+			expected: birth.Dependency{
+				Kind:            birth.KindObject,
+				GVK:             schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"},
+				Name:            "widget",
+				ConditionType:   "Ready",
+				ConditionStatus: "True",
+			},
+		},
+		{
+			name: "explicit status",
+			dep:  "batch/v1/Job/ns/migrate#Failed=False",
+			expected: birth.Dependency{
+				Kind:            birth.KindObject,
+				GVK:             schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"},
+				Namespace:       "ns",
+				Name:            "migrate",
+				ConditionType:   "Failed",
+				ConditionStatus: "False",
+			},
+		},
+		{
+			name: "missing condition",
+			dep:  "apps/v1/Deployment/ns/web",
+			err:  "expected <container>, service/<name>, pods/<selector>, or",
+		},
+		{
+			name: "empty condition type",
+			dep:  "apps/v1/Deployment/ns/web#=True",
+			err:  "missing condition type",
+		},
+		{
+			name: "missing namespace segment",
+			dep:  "apps/v1/Deployment/web#Available",
+			err:  "expected <group>/<version>/<kind>/<namespace>/<name>#<condition>",
+		},
+		{
+			name: "missing name",
+			dep:  "apps/v1/Deployment/ns/#Available",
+			err:  "missing version, kind, or name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dep, err := birth.ParseDependency(tt.dep)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse birth dep: %v", err)
+			}
+			if dep != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, dep)
+			}
+		})
+	}
+}
+
+func TestMetByObject(t *testing.T) {
+	withConditions := func(conditions ...interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"status": map[string]interface{}{"conditions": conditions},
+		}}
+	}
+	condition := func(condType, status string) interface{} {
+		return map[string]interface{}{"type": condType, "status": status}
+	}
+
+	tests := []struct {
+		name string
+		dep  string
+		obj  *unstructured.Unstructured
+		met  bool
+	}{
+		{"true", "apps/v1/Deployment/ns/web#Available", withConditions(condition("Progressing", "False"), condition("Available", "True")), true},
+		{"false", "apps/v1/Deployment/ns/web#Available", withConditions(condition("Available", "False")), false},
+		{"status is case-insensitive", "apps/v1/Deployment/ns/web#Available=true", withConditions(condition("Available", "True")), true},
+		{"explicit false", "batch/v1/Job/ns/migrate#Failed=False", withConditions(condition("Failed", "False")), true},
+		{"explicit false not met", "batch/v1/Job/ns/migrate#Failed=False", withConditions(condition("Failed", "True")), false},
+		{"missing condition", "apps/v1/Deployment/ns/web#Available", withConditions(condition("Progressing", "True")), false},
+		{"no status", "apps/v1/Deployment/ns/web#Available", &unstructured.Unstructured{Object: map[string]interface{}{}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dep, err := birth.ParseDependency(tt.dep)
+			if err != nil {
+				t.Fatalf("failed to parse birth dep: %v", err)
+			}
+			if met := dep.MetByObject(tt.obj); met != tt.met {
+				t.Errorf("expected met=%v, got %v", tt.met, met)
+			}
+		})
+	}
+}
+
+func TestParseServiceAndPodsDependency(t *testing.T) {
+	tests := []struct {
+		dep      string
+		kind     birth.Kind
+		name     string
+		selector string
+		minReady int
+		err      string
+	}{
+		{dep: "service/db", kind: birth.KindService, name: "db", minReady: 1},
+		{dep: "service/db:3", kind: birth.KindService, name: "db", minReady: 3},
+		{dep: " service/db:2 ", kind: birth.KindService, name: "db", minReady: 2},
+		{dep: "service/", err: "missing service name"},
+		{dep: "service/:2", err: "missing service name"},
+		{dep: "service/db:0", err: `invalid min ready count: "0"`},
+		{dep: "service/db:x", err: `invalid min ready count: "x"`},
+		{dep: "pods/app=db", kind: birth.KindPods, selector: "app=db", minReady: 1},
+		{dep: "pods/app=db&tier!=cache:2", kind: birth.KindPods, selector: "app=db,tier!=cache", minReady: 2},
+		{dep: "pods/app in db", err: "invalid pod selector"},
+		{dep: "pods/", err: "missing pod selector"},
+		{dep: "pods/app=db:-1", err: `invalid min ready count: "-1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dep, func(t *testing.T) {
+			dep, err := birth.ParseDependency(tt.dep)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse birth dep: %v", err)
+			}
+			if dep.Kind != tt.kind || dep.Name != tt.name || dep.MinReady != tt.minReady {
+				t.Errorf("expected %s %q with min ready %d, got %+v", tt.kind, tt.name, tt.minReady, dep)
+			}
+			if tt.selector != "" && (dep.Selector == nil || dep.Selector.String() != tt.selector) {
+				t.Errorf("expected selector %q, got %v", tt.selector, dep.Selector)
+			}
+		})
+	}
+}
+
+func TestMetByEndpointSlices(t *testing.T) {
+	notReady := false
+	endpoint := func(pod string, ready bool) discoveryv1.Endpoint {
+		e := discoveryv1.Endpoint{}
+		if pod != "" {
+			e.TargetRef = &corev1.ObjectReference{Kind: "Pod", Namespace: "ns", Name: pod}
+		}
+		if !ready {
+			e.Conditions.Ready = &notReady
+		}
+		return e
+	}
+	slice := func(addressType discoveryv1.AddressType, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+		return &discoveryv1.EndpointSlice{AddressType: addressType, Endpoints: endpoints}
+	}
+	ipv4, ipv6 := discoveryv1.AddressTypeIPv4, discoveryv1.AddressTypeIPv6
+
+	tests := []struct {
+		name   string
+		dep    string
+		slices []*discoveryv1.EndpointSlice
+		met    bool
+	}{
+		{"no slices", "service/db", nil, false},
+		{"ready", "service/db", []*discoveryv1.EndpointSlice{slice(ipv4, endpoint("a", true))}, true},
+		{"not ready", "service/db", []*discoveryv1.EndpointSlice{slice(ipv4, endpoint("a", false))}, false},
+		{"split slices", "service/db:2", []*discoveryv1.EndpointSlice{slice(ipv4, endpoint("a", true)), slice(ipv4, endpoint("b", true))}, true},
+		{"dual-stack counts pods once", "service/db:2", []*discoveryv1.EndpointSlice{slice(ipv4, endpoint("a", true)), slice(ipv6, endpoint("a", true))}, false},
+		{"dual-stack", "service/db:2", []*discoveryv1.EndpointSlice{
+			slice(ipv4, endpoint("a", true), endpoint("b", true)),
+			slice(ipv6, endpoint("a", true), endpoint("b", true)),
+		}, true},
+		{"dual-stack without targets", "service/db:2", []*discoveryv1.EndpointSlice{slice(ipv4, endpoint("", true)), slice(ipv6, endpoint("", true))}, false},
+		{"without targets", "service/db:2", []*discoveryv1.EndpointSlice{slice(ipv4, endpoint("", true), endpoint("", true))}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dep, err := birth.ParseDependency(tt.dep)
+			if err != nil {
+				t.Fatalf("failed to parse birth dep: %v", err)
+			}
+			if met := dep.MetByEndpointSlices(tt.slices); met != tt.met {
+				t.Errorf("expected met=%v, got %v", tt.met, met)
+			}
+		})
+	}
+}
+
+func TestMetByPods(t *testing.T) {
+	pod := func(ready, deleting bool) *corev1.Pod {
+		p := &corev1.Pod{}
+		if ready {
+			p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		} else {
+			p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}}
+		}
+		if deleting {
+			now := metav1.Now()
+			p.DeletionTimestamp = &now
+		}
+		return p
+	}
+
+	tests := []struct {
+		name string
+		dep  string
+		pods []*corev1.Pod
+		met  bool
+	}{
+		{"no pods", "pods/app=db", nil, false},
+		{"ready", "pods/app=db", []*corev1.Pod{pod(true, false)}, true},
+		{"not ready", "pods/app=db", []*corev1.Pod{pod(false, false)}, false},
+		{"deleting", "pods/app=db", []*corev1.Pod{pod(true, true)}, false},
+		{"min ready", "pods/app=db:2", []*corev1.Pod{pod(true, false), pod(false, false), pod(true, true)}, false},
+		{"min ready met", "pods/app=db:2", []*corev1.Pod{pod(true, false), pod(true, false)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dep, err := birth.ParseDependency(tt.dep)
+			if err != nil {
+				t.Fatalf("failed to parse birth dep: %v", err)
+			}
+			if met := dep.MetByPods(tt.pods); met != tt.met {
+				t.Errorf("expected met=%v, got %v", tt.met, met)
+			}
+		})
+	}
+}
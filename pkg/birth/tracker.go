@@ -0,0 +1,127 @@
+package birth
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Tracker tracks which birth dependencies are met and executes a callback
+// once all of them are met.
+// If stability is non-zero, all of the dependencies must stay met for the
+// stability duration before the callback is executed. Any update with a
+// dependency not met resets the stability timer.
+type Tracker struct {
+	deps      []Dependency
+	stability time.Duration
+	callback  func()
+	onChange  func(unmet []Dependency)
+
+	lock  sync.Mutex
+	met   map[string]bool
+	timer *time.Timer
+	// gen identifies the current stability timer, so that a reset timer
+	// that already fired doesn't execute the callback.
+	gen  int
+	done bool
+}
+
+// NewTracker constructs a new Tracker. The callback is executed at most once.
+func NewTracker(deps []Dependency, stability time.Duration, callback func()) *Tracker {
+	return &Tracker{
+		deps:      deps,
+		stability: stability,
+		callback:  callback,
+		met:       map[string]bool{},
+	}
+}
+
+// OnChange registers a hook to be called with the unmet dependencies
+// whenever a dependency becomes met or unmet, until all are met.
+// The hook is called while the tracker is locked, so it must not call the
+// tracker. Must be called before the first Update.
+func (t *Tracker) OnChange(hook func(unmet []Dependency)) {
+	t.onChange = hook
+}
+
+// Unmet returns the dependencies that are not currently met.
+// Safe to call from multiple goroutines.
+func (t *Tracker) Unmet() []Dependency {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.unmet()
+}
+
+func (t *Tracker) unmet() []Dependency {
+	var unmet []Dependency
+	for _, d := range t.deps {
+		if !t.met[d.String()] {
+			unmet = append(unmet, d)
+		}
+	}
+	return unmet
+}
+
+// Update records whether a dependency is currently met.
+// Safe to call from multiple goroutines.
+func (t *Tracker) Update(dep Dependency, met bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.done {
+		return
+	}
+
+	key := dep.String()
+	changed := t.met[key] != met
+	if changed {
+		log.Printf("Birth dep %s: met=%v\n", key, met)
+	}
+	t.met[key] = met
+
+	if changed && t.onChange != nil {
+		t.onChange(t.unmet())
+	}
+
+	for _, d := range t.deps {
+		if !t.met[d.String()] {
+			// at least one birth dep is not ready
+			if t.timer != nil {
+				log.Printf("Birth dep not ready: %s (resetting stability timer)\n", d)
+				t.timer.Stop()
+				t.timer = nil
+			}
+			return
+		}
+	}
+
+	if t.stability <= 0 {
+		t.done = true
+		t.callback()
+		return
+	}
+
+	if t.timer != nil {
+		// already waiting for stability
+		return
+	}
+	log.Printf("All birth deps ready: waiting %s for stability\n", t.stability)
+	t.gen++
+	gen := t.gen
+	t.timer = time.AfterFunc(t.stability, func() {
+		t.fire(gen)
+	})
+}
+
+func (t *Tracker) fire(gen int) {
+	t.lock.Lock()
+	if t.done || t.timer == nil || t.gen != gen {
+		// reset or already fired
+		t.lock.Unlock()
+		return
+	}
+	t.done = true
+	t.lock.Unlock()
+
+	t.callback()
+}
@@ -0,0 +1,241 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/karlkfi/kubexit/pkg/birth"
+	"github.com/karlkfi/kubexit/pkg/tombstone"
+	"github.com/karlkfi/kubexit/pkg/topology"
+)
+
+// Default durations, matching the kubexit defaults.
+const (
+	DefaultBirthTimeout = "30s"
+	DefaultGracePeriod  = "30s"
+)
+
+// EdgeKind is the type of dependency an edge represents.
+type EdgeKind string
+
+const (
+	// Birth edges point from a process to the birth dep it waits for.
+	Birth EdgeKind = "birth"
+	// Death edges point from a process to the death dep it exits with.
+	Death EdgeKind = "death"
+)
+
+// State is the lifecycle state of a process, according to its tombstone.
+type State string
+
+const (
+	// StateUnknown means no graveyard was read, or the node is not a process.
+	StateUnknown State = ""
+	// StateUnborn means the process has not started.
+	StateUnborn State = "unborn"
+	// StateRunning means the process has started and not exited.
+	StateRunning State = "running"
+	// StateExited means the process exited with code 0.
+	StateExited State = "exited"
+	// StateCrashed means the process exited with a non-zero code.
+	StateCrashed State = "crashed"
+	// stateExternal is used to style birth deps on other workloads.
+	stateExternal State = "external"
+)
+
+// Node is a process, or a dependency that is not a process.
+type Node struct {
+	Name string
+	// Process is true if the node is a kubexit process.
+	// Otherwise it is a container or workload that is only named as a dep.
+	Process bool
+	// External is true for birth deps on other workloads (services, pods,
+	// objects), which are not containers in the pod.
+	External bool
+	// Config of the process, if a process.
+	Config topology.Process
+	// Tombstone of the process, if read from a graveyard.
+	Tombstone *tombstone.Tombstone
+}
+
+// State returns the lifecycle state of the node, according to its
+// tombstone, or StateUnknown if no graveyard was read.
+func (g *Graph) State(n *Node) State {
+	if n.External {
+		return stateExternal
+	}
+	// only processes write tombstones
+	if !g.WithState || !n.Process {
+		return StateUnknown
+	}
+	switch {
+	case n.Tombstone == nil || n.Tombstone.Born == nil:
+		return StateUnborn
+	case n.Tombstone.Died == nil:
+		return StateRunning
+	case n.Tombstone.ExitCode != nil && *n.Tombstone.ExitCode != 0:
+		return StateCrashed
+	default:
+		return StateExited
+	}
+}
+
+// Labels returns the lines of the node label: the name, durations, and
+// state.
+func (g *Graph) Labels(n *Node) []string {
+	labels := []string{n.Name}
+	if n.Process {
+		if len(n.Config.BirthDeps) > 0 {
+			labels = append(labels, "birth timeout: "+orDefault(n.Config.BirthTimeout, DefaultBirthTimeout))
+			if n.Config.BirthStability != "" && n.Config.BirthStability != "0s" {
+				labels = append(labels, "birth stability: "+n.Config.BirthStability)
+			}
+		}
+		labels = append(labels, "grace period: "+orDefault(n.Config.GracePeriod, DefaultGracePeriod))
+		if n.Config.Role != "" {
+			labels = append(labels, "role: "+n.Config.Role)
+		}
+		if n.Config.FateGroup != "" {
+			labels = append(labels, "fate group: "+n.Config.FateGroup)
+		}
+	}
+
+	switch g.State(n) {
+	case StateUnborn:
+		labels = append(labels, "unborn")
+		if n.Tombstone != nil && len(n.Tombstone.WaitingFor) > 0 {
+			labels = append(labels, "waiting for: "+strings.Join(n.Tombstone.WaitingFor, ","))
+		}
+	case StateRunning:
+		labels = append(labels, "born: "+n.Tombstone.Born.UTC().Format(time.RFC3339))
+		if n.Tombstone.Restarts > 0 {
+			labels = append(labels, fmt.Sprintf("restarts: %d", n.Tombstone.Restarts))
+		}
+	case StateExited, StateCrashed:
+		labels = append(labels, "born: "+n.Tombstone.Born.UTC().Format(time.RFC3339))
+		labels = append(labels, "died: "+n.Tombstone.Died.UTC().Format(time.RFC3339))
+		if n.Tombstone.ExitCode != nil {
+			labels = append(labels, fmt.Sprintf("exit code: %d", *n.Tombstone.ExitCode))
+		}
+		if n.Tombstone.Restarts > 0 {
+			labels = append(labels, fmt.Sprintf("restarts: %d", n.Tombstone.Restarts))
+		}
+		if n.Tombstone.FailedBy != "" {
+			labels = append(labels, "failed by: "+n.Tombstone.FailedBy)
+		}
+	}
+	return labels
+}
+
+// Edge is a dependency of a process.
+type Edge struct {
+	From  string
+	To    string
+	Kind  EdgeKind
+	Label string
+}
+
+// Graph is the birth and death dependency graph of the processes in a pod.
+type Graph struct {
+	Name  string
+	Nodes []*Node
+	Edges []Edge
+	// WithState is true if the state of the processes was read from a
+	// graveyard.
+	WithState bool
+
+	nodes map[string]*Node
+}
+
+// New returns the dependency graph of a topology.
+// Invalid dependencies are omitted.
+func New(name string, t *topology.Topology) *Graph {
+	g := &Graph{Name: name, nodes: map[string]*Node{}}
+	for _, procName := range t.Names() {
+		proc := t.Processes[procName]
+		node := g.node(procName)
+		node.Process = true
+		node.Config = proc
+
+		for _, depStr := range proc.BirthDeps {
+			dep, err := birth.ParseDependency(depStr)
+			if err != nil {
+				continue
+			}
+			if dep.Kind == birth.KindContainer {
+				g.node(dep.Name)
+				g.Edges = append(g.Edges, Edge{From: procName, To: dep.Name, Kind: Birth, Label: birthLabel(dep)})
+				continue
+			}
+			g.node(dep.String()).External = true
+			g.Edges = append(g.Edges, Edge{From: procName, To: dep.String(), Kind: Birth, Label: string(Birth)})
+		}
+		for _, dep := range proc.DeathDeps {
+			g.node(dep)
+			g.Edges = append(g.Edges, Edge{From: procName, To: dep, Kind: Death, Label: string(Death)})
+		}
+	}
+
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].Name < g.Nodes[j].Name
+	})
+	return g
+}
+
+// FromTombstones returns the dependency graph described by the tombstones in
+// a graveyard, with the state of each process.
+func FromTombstones(name string, tombstones []*tombstone.Tombstone) *Graph {
+	t := &topology.Topology{Processes: map[string]topology.Process{}}
+	for _, ts := range tombstones {
+		t.Processes[ts.Name] = topology.Process{
+			BirthDeps:      ts.BirthDeps,
+			BirthTimeout:   ts.BirthTimeout,
+			BirthStability: ts.BirthStability,
+			DeathDeps:      ts.DeathDeps,
+			GracePeriod:    ts.GracePeriod,
+			Role:           string(ts.Role),
+			FateGroup:      ts.FateGroup,
+		}
+	}
+	g := New(name, t)
+	g.SetState(tombstones)
+	return g
+}
+
+// SetState sets the state of the processes from the tombstones in a
+// graveyard. Processes without tombstones are unborn.
+func (g *Graph) SetState(tombstones []*tombstone.Tombstone) {
+	g.WithState = true
+	for _, ts := range tombstones {
+		if node, ok := g.nodes[ts.Name]; ok {
+			node.Tombstone = ts
+		}
+	}
+}
+
+func (g *Graph) node(name string) *Node {
+	node, ok := g.nodes[name]
+	if !ok {
+		node = &Node{Name: name}
+		g.nodes[name] = node
+		g.Nodes = append(g.Nodes, node)
+	}
+	return node
+}
+
+func birthLabel(dep birth.Dependency) string {
+	condition := dep.Condition
+	if condition == "" {
+		condition = birth.ConditionReady
+	}
+	return fmt.Sprintf("%s: %s", Birth, condition)
+}
+
+func orDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
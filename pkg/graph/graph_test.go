@@ -0,0 +1,146 @@
+package graph
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/karlkfi/kubexit/pkg/tombstone"
+	"github.com/karlkfi/kubexit/pkg/topology"
+)
+
+var update = flag.Bool("update", false, "update the golden graph files in testdata")
+
+// testTopology has birth deps with and without conditions, on containers
+// and other workloads, and death deps.
+var testTopology = &topology.Topology{Processes: map[string]topology.Process{
+	"app": {
+		BirthDeps:      []string{"migrate:succeeded", "proxy", "service/db"},
+		BirthStability: "5s",
+		Role:           "primary",
+		FateGroup:      "main",
+	},
+	"migrate": {},
+	"proxy": {
+		DeathDeps:   []string{"app"},
+		GracePeriod: "10s",
+		Role:        "sidecar",
+	},
+	"worker": {
+		BirthDeps: []string{"app:started"},
+		FateGroup: "main",
+	},
+}}
+
+// testTombstones returns the tombstones of a pod where the migration
+// succeeded, the app is running after a restart, the worker failed, and
+// the proxy is waiting.
+func testTombstones() []*tombstone.Tombstone {
+	born := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	died := born.Add(time.Minute)
+	zero := 0
+	one := 1
+	return []*tombstone.Tombstone{
+		{
+			Name:     "migrate",
+			Born:     &born,
+			Died:     &died,
+			ExitCode: &zero,
+		},
+		{
+			Name:           "app",
+			Born:           &born,
+			Restarts:       2,
+			BirthDeps:      []string{"migrate:succeeded", "proxy", "service/db"},
+			BirthStability: "5s",
+			Role:           tombstone.RolePrimary,
+			FateGroup:      "main",
+		},
+		{
+			Name:      "worker",
+			Born:      &born,
+			Died:      &died,
+			ExitCode:  &one,
+			BirthDeps: []string{"app:started"},
+			FateGroup: "main",
+			FailedBy:  "app",
+		},
+		{
+			Name:        "proxy",
+			WaitingFor:  []string{"app"},
+			DeathDeps:   []string{"app"},
+			GracePeriod: "10s",
+			Role:        tombstone.RoleSidecar,
+		},
+	}
+}
+
+// TestRender renders each graph in both formats, and compares the output to
+// testdata/<case>.dot and testdata/<case>.mmd.
+func TestRender(t *testing.T) {
+	withState := New("pod", testTopology)
+	withState.SetState(testTombstones())
+
+	tests := []struct {
+		name  string
+		graph *Graph
+	}{
+		{"topology", New("pod", testTopology)},
+		{"state", withState},
+		{"tombstones", FromTombstones("/graveyard", testTombstones())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for ext, actual := range map[string]string{
+				".dot": tt.graph.DOT(),
+				".mmd": tt.graph.Mermaid(),
+			} {
+				path := filepath.Join("testdata", tt.name+ext)
+				if *update {
+					err := os.WriteFile(path, []byte(actual), 0644)
+					if err != nil {
+						t.Fatalf("failed to write golden graph: %v", err)
+					}
+					continue
+				}
+				golden, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("failed to read golden graph: %v", err)
+				}
+				if actual != string(golden) {
+					t.Errorf("%s: expected:\n%s\ngot:\n%s", path, golden, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestState(t *testing.T) {
+	g := New("pod", testTopology)
+	for _, node := range g.Nodes {
+		expected := StateUnknown
+		if node.External {
+			expected = stateExternal
+		}
+		if state := g.State(node); state != expected {
+			t.Errorf("%s: expected state %q without graveyard, got %q", node.Name, expected, state)
+		}
+	}
+
+	// processes without tombstones are unborn
+	g.SetState(testTombstones()[:1])
+	expected := map[string]State{
+		"migrate":    StateExited,
+		"app":        StateUnborn,
+		"proxy":      StateUnborn,
+		"worker":     StateUnborn,
+		"service/db": stateExternal,
+	}
+	for _, node := range g.Nodes {
+		if state := g.State(node); state != expected[node.Name] {
+			t.Errorf("%s: expected state %q, got %q", node.Name, expected[node.Name], state)
+		}
+	}
+}
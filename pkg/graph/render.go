@@ -0,0 +1,110 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dotFillColors are the DOT node fill colors, by state.
+var dotFillColors = map[State]string{
+	StateUnborn:  "lightgrey",
+	StateRunning: "lightblue",
+	StateExited:  "palegreen",
+	StateCrashed: "salmon",
+}
+
+// mermaidClasses are the Mermaid node class styles, by state.
+var mermaidClasses = map[State]string{
+	StateUnborn:   "fill:#d3d3d3",
+	StateRunning:  "fill:#add8e6",
+	StateExited:   "fill:#98fb98",
+	StateCrashed:  "fill:#fa8072",
+	stateExternal: "stroke-dasharray:5 5",
+}
+
+// DOT returns the graph in the Graphviz DOT language.
+// Birth edges are solid, death edges are dashed, and birth deps on other
+// workloads are dashed boxes. Processes are colored by state, if known.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(g.Name))
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=ellipse];\n")
+	for _, node := range g.Nodes {
+		attrs := []string{"label=" + dotQuote(strings.Join(g.Labels(node), "\n"))}
+		state := g.State(node)
+		if state == stateExternal {
+			attrs = append(attrs, "shape=box", "style=dashed")
+		} else if color, ok := dotFillColors[state]; ok {
+			attrs = append(attrs, "style=filled", "fillcolor="+color)
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", dotQuote(node.Name), strings.Join(attrs, ", "))
+	}
+	for _, edge := range g.Edges {
+		attrs := []string{"label=" + dotQuote(edge.Label)}
+		if edge.Kind == Death {
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(&b, "  %s -> %s [%s];\n", dotQuote(edge.From), dotQuote(edge.To), strings.Join(attrs, ", "))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotQuote returns a DOT quoted string. Newlines become centered line breaks.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// Mermaid returns the graph as a Mermaid flowchart.
+// Birth edges are solid, death edges are dotted, and birth deps on other
+// workloads are hexagons. Processes are styled by state, if known.
+func (g *Graph) Mermaid() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "---\ntitle: %s\n---\n", mermaidEscape(g.Name))
+	b.WriteString("flowchart LR\n")
+
+	ids := map[string]string{}
+	used := map[State]bool{}
+	for i, node := range g.Nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[node.Name] = id
+		label := mermaidQuote(strings.Join(g.Labels(node), "<br/>"))
+		state := g.State(node)
+		if state == stateExternal {
+			fmt.Fprintf(&b, "  %s{{%s}}\n", id, label)
+		} else {
+			fmt.Fprintf(&b, "  %s(%s)\n", id, label)
+		}
+		if _, ok := mermaidClasses[state]; ok {
+			fmt.Fprintf(&b, "  class %s %s\n", id, state)
+			used[state] = true
+		}
+	}
+	for _, edge := range g.Edges {
+		arrow := "-->"
+		if edge.Kind == Death {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s|%s| %s\n", ids[edge.From], arrow, mermaidQuote(edge.Label), ids[edge.To])
+	}
+	for _, state := range []State{StateUnborn, StateRunning, StateExited, StateCrashed, stateExternal} {
+		if used[state] {
+			fmt.Fprintf(&b, "  classDef %s %s\n", state, mermaidClasses[state])
+		}
+	}
+	return b.String()
+}
+
+// mermaidQuote returns a Mermaid quoted label.
+func mermaidQuote(s string) string {
+	return `"` + mermaidEscape(s) + `"`
+}
+
+// mermaidEscape escapes the characters that would end a Mermaid label.
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
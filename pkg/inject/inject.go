@@ -0,0 +1,299 @@
+package inject
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/karlkfi/kubexit/pkg/podinfo"
+	"github.com/karlkfi/kubexit/pkg/topology"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultImage is the default image to copy the kubexit binary from.
+	DefaultImage = "karlkfi/kubexit:latest"
+	// DefaultGraveyard is the default mount path of the graveyard volume.
+	DefaultGraveyard = "/graveyard"
+	// DefaultBinDir is the default mount path of the volume that the kubexit
+	// binary is copied into.
+	DefaultBinDir = "/kubexit"
+
+	// GraveyardVolumeName is the name of the injected graveyard volume.
+	GraveyardVolumeName = "graveyard"
+	// BinVolumeName is the name of the injected volume that the kubexit
+	// binary is copied into.
+	BinVolumeName = "kubexit"
+	// InitContainerName is the name of the injected init container that
+	// copies the kubexit binary.
+	InitContainerName = "kubexit"
+)
+
+// ErrNoCommand is returned when a container to wrap has no command. The
+// image entrypoint is not known without pulling the image, so kubexit can't
+// be prepended to it, and the command must be set explicitly.
+var ErrNoCommand = errors.New("containers without a command")
+
+// Config configures the injection.
+type Config struct {
+	// Image to copy the kubexit binary from
+	Image string
+	// Graveyard mount path
+	Graveyard string
+	// BinDir is the mount path of the volume the kubexit binary is copied into
+	BinDir string
+	// Deps by container name.
+	// Takes precedence over the deps annotations on the pod.
+	Deps map[string]podinfo.Deps
+}
+
+// WithDefaults returns a copy of the config with defaults for empty fields.
+func (c Config) WithDefaults() Config {
+	if c.Image == "" {
+		c.Image = DefaultImage
+	}
+	if c.Graveyard == "" {
+		c.Graveyard = DefaultGraveyard
+	}
+	if c.BinDir == "" {
+		c.BinDir = DefaultBinDir
+	}
+	return c
+}
+
+// DepsFromAnnotations returns the deps by container name, from the
+// `kubexit.io/deps.<name>` pod annotations.
+func DepsFromAnnotations(annotations map[string]string) (map[string]podinfo.Deps, error) {
+	deps := map[string]podinfo.Deps{}
+	for key, value := range annotations {
+		name := strings.TrimPrefix(key, podinfo.DepsAnnotationPrefix)
+		if name == key {
+			continue
+		}
+		containerDeps, err := podinfo.ParseDeps(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation %s: %v", key, err)
+		}
+		deps[name] = containerDeps
+	}
+	return deps, nil
+}
+
+// PodSpec injects kubexit into the pod spec, wrapping the command of every
+// container with deps, and of every container that is a death dep.
+// Deps are read from the pod annotations and the config, with the config
+// taking precedence, per field.
+// Containers already wrapped with kubexit are left as is, so that injecting
+// more than once makes no further changes.
+// Containers to wrap must have a command, otherwise an error wrapping
+// ErrNoCommand is returned and the pod spec is left unchanged.
+// Returns whether the pod spec was changed.
+func PodSpec(spec *corev1.PodSpec, annotations map[string]string, cfg Config) (bool, error) {
+	cfg = cfg.WithDefaults()
+
+	deps, err := DepsFromAnnotations(annotations)
+	if err != nil {
+		return false, err
+	}
+	for name, override := range cfg.Deps {
+		containerDeps := deps[name]
+		if override.Birth != "" {
+			containerDeps.Birth = override.Birth
+		}
+		if override.Death != "" {
+			containerDeps.Death = override.Death
+		}
+		deps[name] = containerDeps
+	}
+	if len(deps) == 0 {
+		return false, nil
+	}
+
+	wrap, err := validate(spec, deps)
+	if err != nil {
+		return false, err
+	}
+
+	var noCommand []string
+	for _, container := range spec.Containers {
+		if wrap[container.Name] && len(container.Command) == 0 {
+			noCommand = append(noCommand, container.Name)
+		}
+	}
+	if len(noCommand) > 0 {
+		return false, fmt.Errorf("%w: %s: the image entrypoint cannot be wrapped, so the command must be set explicitly",
+			ErrNoCommand, strings.Join(noCommand, ", "))
+	}
+
+	changed := false
+	for i := range spec.Containers {
+		container := &spec.Containers[i]
+		if !wrap[container.Name] || isWrapped(container) {
+			continue
+		}
+		wrapContainer(container, deps[container.Name], cfg)
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+
+	addVolumes(spec)
+	addInitContainer(spec, cfg)
+	return true, nil
+}
+
+// validate checks the deps against the containers in the pod, and returns
+// the names of the containers to wrap.
+// Birth deps may name any container, because readiness is read from the pod
+// status, but death deps must name containers that will write tombstones.
+func validate(spec *corev1.PodSpec, deps map[string]podinfo.Deps) (map[string]bool, error) {
+	topo := &topology.Topology{Processes: map[string]topology.Process{}}
+	for _, container := range spec.InitContainers {
+		topo.Processes[container.Name] = topology.Process{}
+	}
+	for _, container := range spec.Containers {
+		topo.Processes[container.Name] = topology.Process{}
+	}
+
+	wrap := map[string]bool{}
+	for name, containerDeps := range deps {
+		if !hasContainer(spec.Containers, name) {
+			return nil, fmt.Errorf("deps for unknown container: %s", name)
+		}
+		proc := topo.Processes[name]
+		if containerDeps.Birth != "" {
+			proc.BirthDeps = strings.Split(containerDeps.Birth, ",")
+		}
+		if containerDeps.Death != "" {
+			proc.DeathDeps = strings.Split(containerDeps.Death, ",")
+		}
+		topo.Processes[name] = proc
+
+		wrap[name] = true
+		for _, dep := range proc.DeathDeps {
+			if !hasContainer(spec.Containers, dep) {
+				return nil, fmt.Errorf("container %s: death dep is not a container: %s", name, dep)
+			}
+			wrap[dep] = true
+		}
+	}
+
+	err := topo.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return wrap, nil
+}
+
+func hasContainer(containers []corev1.Container, name string) bool {
+	for _, container := range containers {
+		if container.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isWrapped returns true if the container command already runs kubexit.
+func isWrapped(container *corev1.Container) bool {
+	return len(container.Command) > 0 && path.Base(container.Command[0]) == "kubexit"
+}
+
+func wrapContainer(container *corev1.Container, deps podinfo.Deps, cfg Config) {
+	container.Command = append([]string{path.Join(cfg.BinDir, "kubexit")}, container.Command...)
+
+	setEnv(container, corev1.EnvVar{Name: "KUBEXIT_NAME", Value: container.Name})
+	setEnv(container, corev1.EnvVar{Name: "KUBEXIT_GRAVEYARD", Value: cfg.Graveyard})
+	if deps.Death != "" {
+		setEnv(container, corev1.EnvVar{Name: "KUBEXIT_DEATH_DEPS", Value: deps.Death})
+	}
+	if deps.Birth != "" {
+		setEnv(container, corev1.EnvVar{Name: "KUBEXIT_BIRTH_DEPS", Value: deps.Birth})
+		// The pod name cannot always be discovered from the hostname.
+		setEnv(container, fieldRefEnv("KUBEXIT_POD_NAME", "metadata.name"))
+		setEnv(container, fieldRefEnv("KUBEXIT_NAMESPACE", "metadata.namespace"))
+	}
+
+	setVolumeMount(container, corev1.VolumeMount{Name: GraveyardVolumeName, MountPath: cfg.Graveyard})
+	setVolumeMount(container, corev1.VolumeMount{Name: BinVolumeName, MountPath: cfg.BinDir})
+}
+
+func fieldRefEnv(name, fieldPath string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{FieldPath: fieldPath},
+		},
+	}
+}
+
+// setEnv adds or replaces the env var.
+func setEnv(container *corev1.Container, env corev1.EnvVar) {
+	for i := range container.Env {
+		if container.Env[i].Name == env.Name {
+			container.Env[i] = env
+			return
+		}
+	}
+	container.Env = append(container.Env, env)
+}
+
+// setVolumeMount adds the volume mount, unless the volume is already mounted.
+func setVolumeMount(container *corev1.Container, mount corev1.VolumeMount) {
+	for _, existing := range container.VolumeMounts {
+		if existing.Name == mount.Name {
+			return
+		}
+	}
+	container.VolumeMounts = append(container.VolumeMounts, mount)
+}
+
+// addVolumes adds the graveyard and kubexit binary volumes, unless they
+// already exist.
+func addVolumes(spec *corev1.PodSpec) {
+	volumes := map[string]corev1.VolumeSource{
+		GraveyardVolumeName: {EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory}},
+		BinVolumeName:       {EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	}
+	names := make([]string, 0, len(volumes))
+	for name := range volumes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		found := false
+		for _, volume := range spec.Volumes {
+			if volume.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			spec.Volumes = append(spec.Volumes, corev1.Volume{Name: name, VolumeSource: volumes[name]})
+		}
+	}
+}
+
+// addInitContainer adds the init container that copies the kubexit binary,
+// unless it already exists. It runs first, so that later init containers
+// could also use kubexit.
+func addInitContainer(spec *corev1.PodSpec, cfg Config) {
+	if hasContainer(spec.InitContainers, InitContainerName) {
+		return
+	}
+	initContainer := corev1.Container{
+		Name:    InitContainerName,
+		Image:   cfg.Image,
+		Command: []string{"cp", "/bin/kubexit", path.Join(cfg.BinDir, "kubexit")},
+		VolumeMounts: []corev1.VolumeMount{{
+			Name:      BinVolumeName,
+			MountPath: cfg.BinDir,
+		}},
+	}
+	spec.InitContainers = append([]corev1.Container{initContainer}, spec.InitContainers...)
+}
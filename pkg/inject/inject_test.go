@@ -0,0 +1,74 @@
+package inject
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPodSpec(t *testing.T) {
+	spec := &corev1.PodSpec{
+		Containers: []corev1.Container{
+			{Name: "client", Command: []string{"client"}},
+			{Name: "server", Command: []string{"server"}},
+			{Name: "other"},
+		},
+	}
+	annotations := map[string]string{
+		"kubexit.io/deps.client": "birth=server",
+		"kubexit.io/deps.server": "death=client",
+	}
+
+	changed, err := PodSpec(spec, annotations, Config{})
+	if err != nil {
+		t.Fatalf("failed to inject: %v", err)
+	}
+	if !changed {
+		t.Fatal("expected pod spec to be changed")
+	}
+	for _, container := range spec.Containers[:2] {
+		expected := []string{"/kubexit/kubexit", container.Name}
+		if !reflect.DeepEqual(container.Command, expected) {
+			t.Errorf("container %s: expected command %q, got %q", container.Name, expected, container.Command)
+		}
+	}
+	if len(spec.Containers[2].Command) != 0 {
+		t.Errorf("expected container other to be unchanged")
+	}
+	if len(spec.InitContainers) != 1 || spec.InitContainers[0].Name != InitContainerName {
+		t.Errorf("expected init container %s", InitContainerName)
+	}
+
+	// injecting again makes no changes
+	changed, err = PodSpec(spec, annotations, Config{})
+	if err != nil {
+		t.Fatalf("failed to inject again: %v", err)
+	}
+	if changed {
+		t.Error("expected injecting again to make no changes")
+	}
+}
+
+func TestPodSpecNoCommand(t *testing.T) {
+	spec := &corev1.PodSpec{
+		Containers: []corev1.Container{
+			{Name: "client", Command: []string{"client"}},
+			{Name: "server"},
+		},
+	}
+	original := spec.DeepCopy()
+	annotations := map[string]string{
+		"kubexit.io/deps.client": "birth=server",
+		"kubexit.io/deps.server": "death=client",
+	}
+
+	changed, err := PodSpec(spec, annotations, Config{})
+	if !errors.Is(err, ErrNoCommand) {
+		t.Fatalf("expected ErrNoCommand, got: %v", err)
+	}
+	if changed || !reflect.DeepEqual(spec, original) {
+		t.Error("expected pod spec to be unchanged")
+	}
+}
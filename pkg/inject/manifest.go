@@ -0,0 +1,273 @@
+package inject
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// podTemplatePaths are the paths to the pod template metadata and spec, by
+// kind, relative to the root of the object.
+var podTemplatePaths = map[string][]string{
+	"Pod":         nil,
+	"Deployment":  {"spec", "template"},
+	"StatefulSet": {"spec", "template"},
+	"DaemonSet":   {"spec", "template"},
+	"ReplicaSet":  {"spec", "template"},
+	"Job":         {"spec", "template"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template"},
+}
+
+// PodTemplatePath returns the path to the pod template of an object of the
+// kind, relative to the root of the object. The path of a pod is empty.
+// Returns false if objects of the kind do not have a pod template.
+func PodTemplatePath(kind string) ([]string, bool) {
+	templatePath, ok := podTemplatePaths[kind]
+	return templatePath, ok
+}
+
+// WalkObjects reads multi-document YAML and calls fn with each non-empty
+// document and the object it contains. Stops at the first error.
+func WalkObjects(r io.Reader, fn func(doc []byte, obj *unstructured.Unstructured) error) error {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read yaml: %v", err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		obj, err := unmarshalObject(doc)
+		if err != nil {
+			return err
+		}
+		err = fn(doc, obj)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Manifests reads multi-document YAML, injects kubexit into the pods and pod
+// templates, and writes the result as multi-document YAML.
+// Documents of other kinds are written unchanged.
+func Manifests(r io.Reader, w io.Writer, cfg Config) error {
+	first := true
+	return WalkObjects(r, func(doc []byte, obj *unstructured.Unstructured) error {
+		out, err := manifest(doc, obj, cfg)
+		if err != nil {
+			return err
+		}
+
+		if !first {
+			_, err = io.WriteString(w, "---\n")
+			if err != nil {
+				return fmt.Errorf("failed to write yaml: %v", err)
+			}
+		}
+		first = false
+		_, err = w.Write(out)
+		if err != nil {
+			return fmt.Errorf("failed to write yaml: %v", err)
+		}
+		return nil
+	})
+}
+
+// Manifest injects kubexit into a YAML or JSON object with a pod spec, and
+// returns it as YAML. Objects of other kinds are returned unchanged.
+func Manifest(doc []byte, cfg Config) ([]byte, error) {
+	obj, err := unmarshalObject(doc)
+	if err != nil {
+		return nil, err
+	}
+	return manifest(doc, obj, cfg)
+}
+
+func unmarshalObject(doc []byte) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	err := yaml.Unmarshal(doc, &obj.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml: %v", err)
+	}
+	return obj, nil
+}
+
+func manifest(doc []byte, obj *unstructured.Unstructured, cfg Config) ([]byte, error) {
+	templatePath, ok := PodTemplatePath(obj.GetKind())
+	if !ok {
+		return doc, nil
+	}
+
+	changed, err := Object(obj, templatePath, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %v", obj.GetKind(), obj.GetName(), err)
+	}
+	if !changed {
+		return doc, nil
+	}
+
+	out, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal yaml: %v", err)
+	}
+	return out, nil
+}
+
+// PodTemplate returns the annotations and spec of the pod template at the
+// path of the object. An empty path means the object is a pod.
+func PodTemplate(obj *unstructured.Unstructured, templatePath []string) (map[string]string, *corev1.PodSpec, error) {
+	annotationsPath := append(append([]string{}, templatePath...), "metadata", "annotations")
+	annotations, _, err := unstructured.NestedStringMap(obj.Object, annotationsPath...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid annotations: %v", err)
+	}
+
+	specPath := append(append([]string{}, templatePath...), "spec")
+	specMap, found, err := unstructured.NestedMap(obj.Object, specPath...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid pod spec: %v", err)
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("pod spec not found: %s", strings.Join(specPath, "."))
+	}
+
+	spec := &corev1.PodSpec{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(specMap, spec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid pod spec: %v", err)
+	}
+	return annotations, spec, nil
+}
+
+// Object injects kubexit into the pod template at the path of the object.
+// An empty path means the object is a pod.
+// Only the fields that injection changes are written back, so that fields
+// the typed PodSpec doesn't know about are preserved.
+// Returns whether the object was changed.
+func Object(obj *unstructured.Unstructured, templatePath []string, cfg Config) (bool, error) {
+	annotations, spec, err := PodTemplate(obj, templatePath)
+	if err != nil {
+		return false, err
+	}
+
+	original := spec.DeepCopy()
+	changed, err := PodSpec(spec, annotations, cfg)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	specPath := append(append([]string{}, templatePath...), "spec")
+	specMap, _, err := unstructured.NestedMap(obj.Object, specPath...)
+	if err != nil {
+		return false, fmt.Errorf("invalid pod spec: %v", err)
+	}
+	err = applySpec(specMap, original, spec)
+	if err != nil {
+		return false, fmt.Errorf("failed to update pod spec: %v", err)
+	}
+	err = unstructured.SetNestedMap(obj.Object, specMap, specPath...)
+	if err != nil {
+		return false, fmt.Errorf("failed to set pod spec: %v", err)
+	}
+	return true, nil
+}
+
+// applySpec updates the unstructured pod spec with the changes injection
+// made to the original typed pod spec. Injection only prepends init
+// containers, appends volumes, and replaces or appends container commands,
+// env vars, and volume mounts.
+func applySpec(specMap map[string]interface{}, original, injected *corev1.PodSpec) error {
+	added := injected.InitContainers[:len(injected.InitContainers)-len(original.InitContainers)]
+	if len(added) > 0 {
+		initContainers, err := mergeList(nil, nil, added)
+		if err != nil {
+			return err
+		}
+		existing, _ := specMap["initContainers"].([]interface{})
+		specMap["initContainers"] = append(initContainers, existing...)
+	}
+
+	containers, ok := specMap["containers"].([]interface{})
+	if !ok || len(containers) != len(injected.Containers) {
+		return fmt.Errorf("invalid containers")
+	}
+	for i := range injected.Containers {
+		container, ok := containers[i].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid container: %d", i)
+		}
+		before, after := &original.Containers[i], &injected.Containers[i]
+		if !reflect.DeepEqual(before.Command, after.Command) {
+			command := make([]interface{}, len(after.Command))
+			for j := range after.Command {
+				command[j] = after.Command[j]
+			}
+			container["command"] = command
+		}
+		err := setList(container, "env", before.Env, after.Env)
+		if err != nil {
+			return fmt.Errorf("container %s: %v", after.Name, err)
+		}
+		err = setList(container, "volumeMounts", before.VolumeMounts, after.VolumeMounts)
+		if err != nil {
+			return fmt.Errorf("container %s: %v", after.Name, err)
+		}
+	}
+
+	return setList(specMap, "volumes", original.Volumes, injected.Volumes)
+}
+
+// setList sets the unstructured list field to the merged list, unless the
+// list is unchanged.
+func setList[T any](m map[string]interface{}, field string, before, after []T) error {
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+	merged, err := mergeList(m[field], before, after)
+	if err != nil {
+		return err
+	}
+	m[field] = merged
+	return nil
+}
+
+// mergeList returns the unstructured list, with the items that changed from
+// before to after replaced, and the added items appended. Unchanged items
+// are kept as they are, with any unknown fields. The list must not have
+// been shortened.
+func mergeList[T any](list interface{}, before, after []T) ([]interface{}, error) {
+	items, _ := list.([]interface{})
+	if len(items) != len(before) {
+		items = nil
+		before = nil
+	}
+	merged := make([]interface{}, 0, len(after))
+	for i := range after {
+		if i < len(before) && reflect.DeepEqual(before[i], after[i]) {
+			merged = append(merged, items[i])
+			continue
+		}
+		item, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&after[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %T: %v", after[i], err)
+		}
+		merged = append(merged, item)
+	}
+	return merged, nil
+}
@@ -0,0 +1,99 @@
+package inject
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const jobManifest = `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: example
+spec:
+  template:
+    metadata:
+      annotations:
+        kubexit.io/deps.app: death=sidecar
+    spec:
+      restartPolicy: Never
+      futureField:
+        a: 1
+      initContainers:
+      - name: setup
+        image: busybox
+        command: ["true"]
+      containers:
+      - name: app
+        image: app
+        command: [app]
+        futureContainerField: keep
+        env:
+        - name: LOG_LEVEL
+          value: debug
+        - name: KUBEXIT_GRAVEYARD
+          value: /tmp/graveyard
+      - name: sidecar
+        image: sidecar
+        command: [sidecar]
+      - name: unrelated
+        image: unrelated
+      volumes:
+      - name: data
+        emptyDir: {}
+`
+
+// TestManifestPreservesUnknownFields checks that only the fields injection
+// changes are written back, and that they match the injected pod spec.
+func TestManifestPreservesUnknownFields(t *testing.T) {
+	out, err := Manifest([]byte(jobManifest), Config{})
+	if err != nil {
+		t.Fatalf("failed to inject: %v", err)
+	}
+	obj, err := unmarshalObject(out)
+	if err != nil {
+		t.Fatalf("failed to unmarshal output: %v", err)
+	}
+
+	templatePath := []string{"spec", "template"}
+	futureField, found, err := unstructured.NestedMap(obj.Object, "spec", "template", "spec", "futureField")
+	if err != nil || !found || futureField["a"] != float64(1) {
+		t.Errorf("expected pod spec unknown field to be preserved:\n%s", out)
+	}
+	containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+	if len(containers) != 3 {
+		t.Fatalf("expected 3 containers, got %d:\n%s", len(containers), out)
+	}
+	if containers[0].(map[string]interface{})["futureContainerField"] != "keep" {
+		t.Errorf("expected container unknown field to be preserved:\n%s", out)
+	}
+	for _, container := range containers {
+		if _, found := container.(map[string]interface{})["resources"]; found {
+			t.Errorf("expected no resources to be added:\n%s", out)
+		}
+	}
+
+	expectedObj, err := unmarshalObject([]byte(jobManifest))
+	if err != nil {
+		t.Fatalf("failed to unmarshal manifest: %v", err)
+	}
+	annotations, expected, err := PodTemplate(expectedObj, templatePath)
+	if err != nil {
+		t.Fatalf("failed to read pod template: %v", err)
+	}
+	_, err = PodSpec(expected, annotations, Config{})
+	if err != nil {
+		t.Fatalf("failed to inject pod spec: %v", err)
+	}
+	_, actual, err := PodTemplate(obj, templatePath)
+	if err != nil {
+		t.Fatalf("failed to read injected pod template: %v", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected injected spec:\n%+v\ngot:\n%+v", expected, actual)
+	}
+	if actual.InitContainers[0].Name != InitContainerName || actual.InitContainers[1].Name != "setup" {
+		t.Errorf("expected %s init container first, got: %+v", InitContainerName, actual.InitContainers)
+	}
+}
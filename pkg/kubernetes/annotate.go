@@ -0,0 +1,48 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// TombstoneAnnotationPrefix is the prefix of the pod annotations that mirror
+// tombstones. The tombstone name is appended.
+const TombstoneAnnotationPrefix = "kubexit.io/tombstone."
+
+// TombstoneAnnotationKey returns the key of the pod annotation that mirrors
+// the named tombstone. Errors if the key is not a valid annotation key, for
+// example if the name is longer than 53 characters, because the API server
+// would reject every patch.
+func TombstoneAnnotationKey(name string) (string, error) {
+	key := TombstoneAnnotationPrefix + name
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return "", fmt.Errorf("invalid tombstone annotation key: %s: %s", key, strings.Join(errs, ", "))
+	}
+	return key, nil
+}
+
+// AnnotatePod sets annotations on a pod with a JSON merge patch.
+// Other annotations are left unchanged.
+func AnnotatePod(ctx context.Context, clientset kubernetes.Interface, namespace, podName string, annotations map[string]string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pod annotation patch: %v", err)
+	}
+	_, err = clientset.CoreV1().Pods(namespace).Patch(ctx, podName, types.MergePatchType, data, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to patch pod annotations: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTombstoneAnnotationKey(t *testing.T) {
+	key, err := TombstoneAnnotationKey("app")
+	if err != nil || key != "kubexit.io/tombstone.app" {
+		t.Errorf("expected kubexit.io/tombstone.app, got %q (%v)", key, err)
+	}
+
+	// the name part after the prefix is limited to 63 characters
+	longest := strings.Repeat("a", 63-len("tombstone."))
+	if _, err := TombstoneAnnotationKey(longest); err != nil {
+		t.Errorf("expected %d character name to be valid: %v", len(longest), err)
+	}
+	_, err = TombstoneAnnotationKey(longest + "a")
+	if err == nil || !strings.Contains(err.Error(), "must be no more than 63 bytes") {
+		t.Errorf("expected name length error, got: %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SetPodCondition sets a pod status condition, such as a custom readiness
+// gate condition, with a strategic merge patch. Other conditions are left
+// unchanged, because conditions are merged by type.
+func SetPodCondition(ctx context.Context, clientset kubernetes.Interface, namespace, podName string, condType corev1.PodConditionType, status corev1.ConditionStatus, reason, message string) error {
+	patch := map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []corev1.PodCondition{{
+				Type:               condType,
+				Status:             status,
+				LastTransitionTime: metav1.Now(),
+				Reason:             reason,
+				Message:            message,
+			}},
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pod condition patch: %v", err)
+	}
+	_, err = clientset.CoreV1().Pods(namespace).Patch(ctx, podName, types.StrategicMergePatchType, data, metav1.PatchOptions{}, "status")
+	if err != nil {
+		return fmt.Errorf("failed to patch pod condition %s: %v", condType, err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// UserAgent is the user agent used by kubexit kubernetes clients.
+const UserAgent = "kubexit"
+
+// ConfigOptions configures how the kubernetes client config is loaded.
+type ConfigOptions struct {
+	// Context is the kubeconfig context to use. If empty, the current context
+	// is used. Only used out-of-cluster.
+	Context string
+	// QPS is the maximum queries per second to the API server.
+	// If zero, the client-go default is used.
+	QPS float32
+	// Burst is the maximum burst of queries to the API server.
+	// If zero, the client-go default is used.
+	Burst int
+}
+
+// NewConfig returns a kubernetes client config, and the namespace of the
+// kubeconfig context, if loaded from a kubeconfig.
+// The pod service account is used when running in a pod, unless a context is
+// explicitly specified. Otherwise a kubeconfig is loaded from the KUBECONFIG
+// env var or ~/.kube/config. The namespace of a kubeconfig context without a
+// namespace is `default`, like kubectl. The namespace is empty in-cluster,
+// because it is read from the service account by DiscoverNamespace.
+func NewConfig(opts ConfigOptions) (*rest.Config, string, error) {
+	var config *rest.Config
+	var namespace string
+	var err error
+	if opts.Context == "" {
+		config, err = rest.InClusterConfig()
+		if err != nil && !errors.Is(err, rest.ErrNotInCluster) {
+			return nil, "", fmt.Errorf("failed to configure kubernetes client: %v", err)
+		}
+	}
+	if config == nil {
+		log.Println("Kubernetes Config: kubeconfig")
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		overrides := &clientcmd.ConfigOverrides{
+			CurrentContext: opts.Context,
+		}
+		clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+		config, err = clientConfig.ClientConfig()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to configure kubernetes client from kubeconfig: %v", err)
+		}
+		namespace, _, err = clientConfig.Namespace()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read namespace from kubeconfig: %v", err)
+		}
+	} else {
+		log.Println("Kubernetes Config: in-cluster")
+	}
+
+	if opts.QPS > 0 {
+		config.QPS = opts.QPS
+	}
+	if opts.Burst > 0 {
+		config.Burst = opts.Burst
+	}
+	config.UserAgent = UserAgent
+	return config, namespace, nil
+}
+
+// Clients are the kubernetes clients used to watch birth dependencies.
+// Any of them may be replaced with fakes for testing.
+type Clients struct {
+	Kube    kubernetes.Interface
+	Dynamic dynamic.Interface
+	Mapper  meta.RESTMapper
+}
+
+// NewClients returns kubernetes clients for the supplied config.
+// The RESTMapper uses discovery lazily, on first use.
+func NewClients(config *rest.Config) (*Clients, error) {
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes dynamic client: %v", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes discovery client: %v", err)
+	}
+	return &Clients{
+		Kube:    kubeClient,
+		Dynamic: dynamicClient,
+		Mapper:  restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)),
+	}, nil
+}
@@ -0,0 +1,147 @@
+package kubernetes
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: current
+clusters:
+- name: current
+  cluster:
+    server: https://current.example.com
+- name: other
+  cluster:
+    server: https://other.example.com
+users:
+- name: user
+  user:
+    token: secret
+contexts:
+- name: current
+  context:
+    cluster: current
+    user: user
+    namespace: current-ns
+- name: other
+  context:
+    cluster: other
+    user: user
+`
+
+// setKubeconfig writes the test kubeconfig and configures NewConfig to load
+// it, out-of-cluster unless inCluster is true.
+func setKubeconfig(t *testing.T, inCluster bool) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(path, []byte(testKubeconfig), 0600)
+	if err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	t.Setenv("KUBECONFIG", path)
+	if inCluster {
+		t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+		t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	} else {
+		t.Setenv("KUBERNETES_SERVICE_HOST", "")
+		t.Setenv("KUBERNETES_SERVICE_PORT", "")
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		inCluster bool
+		opts      ConfigOptions
+		host      string
+		namespace string
+		err       string
+	}{
+		{
+			name:      "current context",
+			host:      "https://current.example.com",
+			namespace: "current-ns",
+		},
+		{
+			name:      "selected context without namespace",
+			opts:      ConfigOptions{Context: "other"},
+			host:      "https://other.example.com",
+			namespace: "default",
+		},
+		{
+			name: "unknown context",
+			opts: ConfigOptions{Context: "missing"},
+			err:  "failed to configure kubernetes client from kubeconfig",
+		},
+		{
+			// the service account token is not mounted in tests, so using
+			// the in-cluster config fails
+			name:      "in-cluster before kubeconfig",
+			inCluster: true,
+			err:       "failed to configure kubernetes client:",
+		},
+		{
+			name:      "selected context before in-cluster",
+			inCluster: true,
+			opts:      ConfigOptions{Context: "current"},
+			host:      "https://current.example.com",
+			namespace: "current-ns",
+		},
+		{
+			name:      "rate limits",
+			opts:      ConfigOptions{QPS: 50, Burst: 100},
+			host:      "https://current.example.com",
+			namespace: "current-ns",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := os.Stat(filepath.Dir(ServiceAccountNamespacePath)); tt.inCluster && tt.err != "" && err == nil {
+				t.Skip("running in a pod with a service account")
+			}
+			setKubeconfig(t, tt.inCluster)
+
+			config, namespace, err := NewConfig(tt.opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to create config: %v", err)
+			}
+			if config.Host != tt.host {
+				t.Errorf("expected host %q, got %q", tt.host, config.Host)
+			}
+			if namespace != tt.namespace {
+				t.Errorf("expected namespace %q, got %q", tt.namespace, namespace)
+			}
+			if config.UserAgent != UserAgent {
+				t.Errorf("expected user agent %q, got %q", UserAgent, config.UserAgent)
+			}
+			if config.QPS != tt.opts.QPS || config.Burst != tt.opts.Burst {
+				t.Errorf("expected qps %v and burst %d, got %v and %d", tt.opts.QPS, tt.opts.Burst, config.QPS, config.Burst)
+			}
+		})
+	}
+}
+
+func TestNewClients(t *testing.T) {
+	setKubeconfig(t, false)
+	config, _, err := NewConfig(ConfigOptions{})
+	if err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+	clients, err := NewClients(config)
+	if err != nil {
+		t.Fatalf("failed to create clients: %v", err)
+	}
+	if clients.Kube == nil || clients.Dynamic == nil || clients.Mapper == nil {
+		t.Errorf("expected all clients, got: %+v", clients)
+	}
+}
@@ -0,0 +1,94 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ServiceAccountNamespacePath is the path of the file containing the pod
+// namespace, mounted into every container with a service account token.
+const ServiceAccountNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// DiscoverNamespace returns the pod namespace from the service account
+// namespace file.
+func DiscoverNamespace() (string, error) {
+	bytes, err := os.ReadFile(ServiceAccountNamespacePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to discover namespace: %v", err)
+	}
+	namespace := strings.TrimSpace(string(bytes))
+	if namespace == "" {
+		return "", fmt.Errorf("failed to discover namespace: empty file: %s", ServiceAccountNamespacePath)
+	}
+	return namespace, nil
+}
+
+// PodInfoNameFile is the name of the Downward API volume file containing the
+// pod name (`metadata.name`), next to the annotations file.
+const PodInfoNameFile = "name"
+
+// maxHostnameLength is the maximum length of a hostname. Longer pod names
+// are truncated by the kubelet, so the hostname is not the pod name.
+const maxHostnameLength = 63
+
+// DiscoverPodName returns the pod name from the Downward API pod name file in
+// the podInfoDir, if any, or otherwise from the HOSTNAME env var, after
+// verifying that a pod with that name exists in the namespace and has a
+// container with the supplied name.
+// The hostname is not the pod name when the pod uses the host network,
+// specifies its own hostname, or has a name longer than 63 characters, in
+// which case an error is returned.
+func DiscoverPodName(ctx context.Context, clientset kubernetes.Interface, namespace, containerName, podInfoDir string) (string, error) {
+	if podInfoDir != "" {
+		data, err := os.ReadFile(filepath.Join(podInfoDir, PodInfoNameFile))
+		if err == nil && strings.TrimSpace(string(data)) != "" {
+			return verifyPodName(ctx, clientset, namespace, containerName, strings.TrimSpace(string(data)), "pod info name")
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to discover pod name: %v", err)
+		}
+	}
+
+	hostname := os.Getenv("HOSTNAME")
+	if hostname == "" {
+		var err error
+		hostname, err = os.Hostname()
+		if err != nil {
+			return "", fmt.Errorf("failed to discover pod name: failed to read hostname: %v", err)
+		}
+	}
+	return verifyPodName(ctx, clientset, namespace, containerName, hostname, "hostname")
+}
+
+// verifyPodName returns the pod name, if a pod with that name exists in the
+// namespace and has a container with the supplied name. The source of the
+// name is used in errors.
+func verifyPodName(ctx context.Context, clientset kubernetes.Interface, namespace, containerName, podName, source string) (string, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		reason := "host network or custom hostname?"
+		if source == "hostname" && len(podName) == maxHostnameLength {
+			reason = fmt.Sprintf("pod name longer than %d characters?", maxHostnameLength)
+		}
+		return "", fmt.Errorf("failed to discover pod name: %s %q is not a pod in namespace %q (%s): "+
+			"set KUBEXIT_POD_NAME explicitly", source, podName, namespace, reason)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to discover pod name: failed to get pod %q: %v", podName, err)
+	}
+
+	for _, container := range pod.Spec.Containers {
+		if container.Name == containerName {
+			return pod.Name, nil
+		}
+	}
+	return "", fmt.Errorf("failed to discover pod name: pod %q matches %s, but has no container named %q: "+
+		"set KUBEXIT_POD_NAME explicitly", podName, source, containerName)
+}
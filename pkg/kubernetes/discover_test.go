@@ -0,0 +1,71 @@
+package kubernetes
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newDiscoverClientset(podName string) *fake.Clientset {
+	return fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: podName, Namespace: "ns"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	})
+}
+
+func TestDiscoverPodNameFromFile(t *testing.T) {
+	longName := strings.Repeat("a", maxHostnameLength+10)
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, PodInfoNameFile), []byte(longName), 0644)
+	if err != nil {
+		t.Fatalf("failed to write name file: %v", err)
+	}
+	t.Setenv("HOSTNAME", longName[:maxHostnameLength])
+
+	podName, err := DiscoverPodName(context.Background(), newDiscoverClientset(longName), "ns", "app", dir)
+	if err != nil {
+		t.Fatalf("failed to discover pod name: %v", err)
+	}
+	if podName != longName {
+		t.Errorf("expected %q, got %q", longName, podName)
+	}
+}
+
+func TestDiscoverPodNameFromHostname(t *testing.T) {
+	t.Setenv("HOSTNAME", "pod")
+
+	// missing name file falls back to the hostname
+	podName, err := DiscoverPodName(context.Background(), newDiscoverClientset("pod"), "ns", "app", t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to discover pod name: %v", err)
+	}
+	if podName != "pod" {
+		t.Errorf("expected %q, got %q", "pod", podName)
+	}
+
+	_, err = DiscoverPodName(context.Background(), newDiscoverClientset("pod"), "ns", "other", "")
+	if err == nil || !strings.Contains(err.Error(), "KUBEXIT_POD_NAME") {
+		t.Errorf("expected missing container error, got: %v", err)
+	}
+}
+
+func TestDiscoverPodNameTruncatedHostname(t *testing.T) {
+	longName := strings.Repeat("a", maxHostnameLength+10)
+	t.Setenv("HOSTNAME", longName[:maxHostnameLength])
+
+	_, err := DiscoverPodName(context.Background(), newDiscoverClientset(longName), "ns", "app", "")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "longer than 63 characters") || !strings.Contains(err.Error(), "KUBEXIT_POD_NAME") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// maxPendingEvents is the maximum number of events waiting to be written.
+// It is well below the queue length of the event broadcaster, which drops
+// events silently when full, so that every pending event is written (or
+// fails) and Flush doesn't wait for dropped events.
+const maxPendingEvents = 100
+
+// Recorder records Kubernetes Events on a container in a pod.
+// Events are rate limited and aggregated by the client-go event correlator.
+// A nil *Recorder is valid and records nothing, so that events are optional.
+type Recorder struct {
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	ref         *corev1.ObjectReference
+	pending     sync.WaitGroup
+	queued      atomic.Int32
+}
+
+// NewRecorder returns a Recorder for the named container in a pod.
+// Returns nil, with a logged warning, if the client is not allowed to create
+// events, because events are optional.
+func NewRecorder(ctx context.Context, clientset kubernetes.Interface, namespace, podName, containerName string) *Recorder {
+	missing, err := CheckPermissions(ctx, clientset, []Permission{{
+		Resource:  "events",
+		Namespace: namespace,
+		Verbs:     []string{"create", "patch"},
+	}})
+	if err != nil {
+		log.Printf("Warning: failed to check event permissions: %v\n", err)
+	} else if len(missing) > 0 {
+		log.Printf("Warning: events disabled: missing RBAC permissions: %s\n", missing[0])
+		return nil
+	}
+
+	ref := &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  namespace,
+		Name:       podName,
+		FieldPath:  fmt.Sprintf("spec.containers{%s}", containerName),
+	}
+	// The pod UID is required for `kubectl describe pod` to show the events.
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Warning: failed to get pod for events: %v\n", err)
+	} else {
+		ref.UID = pod.UID
+		ref.ResourceVersion = pod.ResourceVersion
+	}
+
+	r := &Recorder{
+		broadcaster: record.NewBroadcaster(),
+		ref:         ref,
+	}
+
+	sink := &typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events(namespace)}
+	correlator := record.NewEventCorrelatorWithOptions(record.CorrelatorOptions{})
+	r.broadcaster.StartEventWatcher(func(event *corev1.Event) {
+		defer r.done()
+		r.recordToSink(sink, correlator, event)
+	})
+	r.recorder = r.broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{
+		Component: UserAgent,
+	})
+	return r
+}
+
+// recordToSink writes the event to the sink once, without retries.
+func (r *Recorder) recordToSink(sink record.EventSink, correlator *record.EventCorrelator, event *corev1.Event) {
+	// Copy before modification, because there could be multiple listeners.
+	eventCopy := *event
+	event = &eventCopy
+
+	result, err := correlator.EventCorrelate(event)
+	if err != nil {
+		log.Printf("Warning: failed to correlate event: %v\n", err)
+	}
+	if result.Skip {
+		// rate limited
+		return
+	}
+
+	var newEvent *corev1.Event
+	if result.Event.Count > 1 {
+		newEvent, err = sink.Patch(result.Event, result.Patch)
+	}
+	if result.Event.Count <= 1 || apierrors.IsNotFound(err) {
+		result.Event.ResourceVersion = ""
+		newEvent, err = sink.Create(result.Event)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to record event: %v\n", err)
+		return
+	}
+	correlator.UpdateState(newEvent)
+}
+
+// Eventf records a Normal event.
+func (r *Recorder) Eventf(reason, messageFmt string, args ...interface{}) {
+	r.record(corev1.EventTypeNormal, reason, messageFmt, args...)
+}
+
+// Warningf records a Warning event.
+func (r *Recorder) Warningf(reason, messageFmt string, args ...interface{}) {
+	r.record(corev1.EventTypeWarning, reason, messageFmt, args...)
+}
+
+func (r *Recorder) record(eventType, reason, messageFmt string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+	if r.queued.Add(1) > maxPendingEvents {
+		r.queued.Add(-1)
+		log.Printf("Warning: dropped event: too many pending events: %s\n", reason)
+		return
+	}
+	r.pending.Add(1)
+	r.recorder.Eventf(r.ref, eventType, reason, messageFmt, args...)
+}
+
+func (r *Recorder) done() {
+	r.queued.Add(-1)
+	r.pending.Done()
+}
+
+// Flush waits up to timeout for recorded events to be written, and then stops
+// recording. Events recorded after Flush are dropped.
+func (r *Recorder) Flush(timeout time.Duration) {
+	if r == nil {
+		return
+	}
+	doneCh := make(chan struct{})
+	go func() {
+		r.pending.Wait()
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+	case <-time.After(timeout):
+		log.Println("Warning: timed out writing events")
+	}
+	r.broadcaster.Shutdown()
+}
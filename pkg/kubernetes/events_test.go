@@ -0,0 +1,78 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newEventsClientset returns a fake clientset that allows everything, with a
+// pod.
+func newEventsClientset() *fake.Clientset {
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns", UID: "uid"},
+	})
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &authorizationv1.SelfSubjectAccessReview{
+			Status: authorizationv1.SubjectAccessReviewStatus{Allowed: true},
+		}, nil
+	})
+	return clientset
+}
+
+func TestRecorderFlush(t *testing.T) {
+	clientset := newEventsClientset()
+	r := NewRecorder(context.Background(), clientset, "ns", "pod", "app")
+	if r == nil {
+		t.Fatal("expected recorder")
+	}
+
+	r.Eventf("Started", "Started child process")
+	r.Warningf("Exited", "Child process exited(%d)", 1)
+	r.Flush(5 * time.Second)
+
+	events, err := clientset.CoreV1().Events("ns").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list events: %v", err)
+	}
+	if len(events.Items) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events.Items))
+	}
+	for _, event := range events.Items {
+		if event.InvolvedObject.UID != "uid" || event.InvolvedObject.FieldPath != "spec.containers{app}" {
+			t.Errorf("unexpected involved object: %+v", event.InvolvedObject)
+		}
+	}
+}
+
+func TestRecorderFlushTooManyEvents(t *testing.T) {
+	clientset := newEventsClientset()
+	r := NewRecorder(context.Background(), clientset, "ns", "pod", "app")
+	if r == nil {
+		t.Fatal("expected recorder")
+	}
+
+	// more than the broadcaster queue length, which drops events when full
+	for i := 0; i < 2000; i++ {
+		r.Eventf("Spam", "Event %d", i)
+	}
+	start := time.Now()
+	r.Flush(5 * time.Second)
+	if elapsed := time.Since(start); elapsed >= 5*time.Second {
+		t.Fatalf("expected Flush to return before the timeout, took %s", elapsed)
+	}
+}
+
+func TestRecorderNil(t *testing.T) {
+	var r *Recorder
+	r.Eventf("Started", "Started child process")
+	r.Warningf("Exited", "Child process exited(%d)", 1)
+	r.Flush(time.Second)
+}
@@ -0,0 +1,178 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// PodsHandler is called with the current set of pods whenever it changes.
+type PodsHandler func([]*corev1.Pod)
+
+// EndpointSlicesHandler is called with the current set of endpoint slices
+// whenever it changes.
+type EndpointSlicesHandler func([]*discoveryv1.EndpointSlice)
+
+// WatchPods watches the pods matching a label selector and calls the
+// podsHandler (asyncronously) with all matching pods when any of them change.
+// When the supplied context is canceled, watching will stop.
+// The returned channel receives nil when watching stops because the context
+// was canceled, or an error if List or Watch failed after retries.
+func WatchPods(ctx context.Context, clientset kubernetes.Interface, namespace string, selector labels.Selector, podsHandler PodsHandler) (<-chan error, error) {
+	labelSelector := selector.String()
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = labelSelector
+			return clientset.CoreV1().Pods(namespace).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = labelSelector
+			return clientset.CoreV1().Pods(namespace).Watch(ctx, options)
+		},
+	}
+
+	desc := fmt.Sprintf("Pods Watch(%s)", labelSelector)
+	return runInformer(ctx, desc, lw, clientset, &corev1.Pod{}, func(objs []interface{}) {
+		pods := make([]*corev1.Pod, 0, len(objs))
+		for _, obj := range objs {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				pods = append(pods, pod)
+			}
+		}
+		podsHandler(pods)
+	})
+}
+
+// WatchServiceEndpoints watches the endpoint slices of a service and calls
+// the slicesHandler (asyncronously) with all of the service's endpoint slices
+// when any of them change.
+// When the supplied context is canceled, watching will stop.
+// The returned channel receives nil when watching stops because the context
+// was canceled, or an error if List or Watch failed after retries.
+func WatchServiceEndpoints(ctx context.Context, clientset kubernetes.Interface, namespace, serviceName string, slicesHandler EndpointSlicesHandler) (<-chan error, error) {
+	labelSelector := labels.SelectorFromSet(labels.Set{
+		discoveryv1.LabelServiceName: serviceName,
+	}).String()
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = labelSelector
+			return clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = labelSelector
+			return clientset.DiscoveryV1().EndpointSlices(namespace).Watch(ctx, options)
+		},
+	}
+
+	desc := fmt.Sprintf("Service Watch(%s)", serviceName)
+	return runInformer(ctx, desc, lw, clientset, &discoveryv1.EndpointSlice{}, func(objs []interface{}) {
+		slices := make([]*discoveryv1.EndpointSlice, 0, len(objs))
+		for _, obj := range objs {
+			if slice, ok := obj.(*discoveryv1.EndpointSlice); ok {
+				slices = append(slices, slice)
+			}
+		}
+		slicesHandler(slices)
+	})
+}
+
+// runInformer runs an informer in the background until the context is
+// canceled, calling the handler with the full contents of the informer store
+// after every add, update, or delete.
+// The informer retries failed Lists and Watches forever, with its own
+// backoff, so watching stops after WatchBackoff.Steps consecutive failures,
+// and the last error is sent on the returned channel. Otherwise the channel
+// receives nil when the context is canceled.
+func runInformer(ctx context.Context, desc string, lw *cache.ListWatch, client any, objType runtime.Object, handler func([]interface{})) (<-chan error, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var lock sync.Mutex
+	var failures int
+	var watchErr error
+	record := func(err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if err == nil {
+			// only consecutive failures count towards the limit
+			failures = 0
+			return
+		}
+		failures++
+		if failures >= WatchBackoff.Steps && watchErr == nil {
+			watchErr = err
+			cancel()
+		}
+	}
+	countingLW := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			obj, err := lw.ListFunc(options)
+			record(err)
+			return obj, err
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			w, err := lw.WatchFunc(options)
+			record(err)
+			return w, err
+		},
+	}
+
+	informer := cache.NewSharedIndexInformer(withWatchListSemantics(countingLW, client), objType, 0, cache.Indexers{})
+	store := informer.GetStore()
+	onChange := func() {
+		handler(store.List())
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { onChange() },
+		UpdateFunc: func(interface{}, interface{}) { onChange() },
+		DeleteFunc: func(interface{}) { onChange() },
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to add informer event handler: %v", err)
+	}
+	err = informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		log.Printf("%s: recoverable error: %v\n", desc, err)
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to set informer error handler: %v", err)
+	}
+
+	resultCh := make(chan error, 1)
+	go func() {
+		defer close(resultCh)
+		defer cancel()
+		informer.Run(ctx.Done())
+
+		lock.Lock()
+		err := watchErr
+		lock.Unlock()
+		if err != nil {
+			log.Printf("%s: terminal error: %v\n", desc, err)
+			resultCh <- fmt.Errorf("%s: %v", desc, err)
+			return
+		}
+		log.Printf("%s: done\n", desc)
+		resultCh <- nil
+	}()
+
+	go func() {
+		// Call the handler once after the initial list, even if empty,
+		// so that the handler knows the current state.
+		if cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			onChange()
+		}
+	}()
+
+	return resultCh, nil
+}
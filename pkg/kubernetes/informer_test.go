@@ -0,0 +1,171 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newLabeledPod(name string, podLabels map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", Labels: podLabels},
+	}
+}
+
+func newEndpointSlice(name, serviceName string) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "ns",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: serviceName},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+	}
+}
+
+// waitForNames waits for the handler to be called with objects with exactly
+// the expected names, or fails the test.
+func waitForNames(t *testing.T, names <-chan []string, expected ...string) {
+	t.Helper()
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case actual := <-names:
+			if strings.Join(actual, ",") == strings.Join(expected, ",") {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %v", expected)
+		}
+	}
+}
+
+func TestWatchPods(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clientset := fake.NewSimpleClientset(
+		newLabeledPod("a", map[string]string{"app": "db"}),
+		newLabeledPod("other", map[string]string{"app": "web"}),
+	)
+	names := make(chan []string, 100)
+	resultCh, err := WatchPods(ctx, clientset, "ns", labels.SelectorFromSet(labels.Set{"app": "db"}), func(pods []*corev1.Pod) {
+		var podNames []string
+		for _, pod := range pods {
+			podNames = append(podNames, pod.Name)
+		}
+		names <- sortedNames(podNames)
+	})
+	if err != nil {
+		t.Fatalf("failed to watch pods: %v", err)
+	}
+	waitForNames(t, names, "a")
+
+	_, err = clientset.CoreV1().Pods("ns").Create(ctx, newLabeledPod("b", map[string]string{"app": "db"}), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("failed to create pod: %v", err)
+	}
+	waitForNames(t, names, "a", "b")
+
+	cancel()
+	if err := waitForResult(t, resultCh); err != nil {
+		t.Errorf("expected nil result after cancel, got: %v", err)
+	}
+}
+
+func TestWatchServiceEndpoints(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clientset := fake.NewSimpleClientset(
+		newEndpointSlice("db-ipv4", "db"),
+		newEndpointSlice("web-ipv4", "web"),
+	)
+	names := make(chan []string, 100)
+	resultCh, err := WatchServiceEndpoints(ctx, clientset, "ns", "db", func(slices []*discoveryv1.EndpointSlice) {
+		var sliceNames []string
+		for _, slice := range slices {
+			sliceNames = append(sliceNames, slice.Name)
+		}
+		names <- sortedNames(sliceNames)
+	})
+	if err != nil {
+		t.Fatalf("failed to watch service endpoints: %v", err)
+	}
+	waitForNames(t, names, "db-ipv4")
+
+	_, err = clientset.DiscoveryV1().EndpointSlices("ns").Create(ctx, newEndpointSlice("db-ipv6", "db"), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("failed to create endpoint slice: %v", err)
+	}
+	waitForNames(t, names, "db-ipv4", "db-ipv6")
+
+	cancel()
+	if err := waitForResult(t, resultCh); err != nil {
+		t.Errorf("expected nil result after cancel, got: %v", err)
+	}
+}
+
+func TestWatchInformerForbidden(t *testing.T) {
+	backoff := WatchBackoff
+	defer func() { WatchBackoff = backoff }()
+	WatchBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 2.0, Steps: 2}
+
+	tests := []struct {
+		resource string
+		watch    func(ctx context.Context, clientset *fake.Clientset) (<-chan error, error)
+	}{
+		{
+			resource: "pods",
+			watch: func(ctx context.Context, clientset *fake.Clientset) (<-chan error, error) {
+				return WatchPods(ctx, clientset, "ns", labels.Everything(), func([]*corev1.Pod) {})
+			},
+		},
+		{
+			resource: "endpointslices",
+			watch: func(ctx context.Context, clientset *fake.Clientset) (<-chan error, error) {
+				return WatchServiceEndpoints(ctx, clientset, "ns", "db", func([]*discoveryv1.EndpointSlice) {})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resource, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			clientset := fake.NewSimpleClientset()
+			clientset.PrependReactor("list", tt.resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, apierrors.NewForbidden(action.GetResource().GroupResource(), "", errors.New("not allowed"))
+			})
+			resultCh, err := tt.watch(ctx, clientset)
+			if err != nil {
+				t.Fatalf("failed to watch: %v", err)
+			}
+
+			err = waitForResult(t, resultCh)
+			if err == nil || !strings.Contains(err.Error(), "forbidden") {
+				t.Fatalf("expected forbidden error, got: %v", err)
+			}
+		})
+	}
+}
+
+// sortedNames returns the names sorted, because the informer store is not
+// ordered.
+func sortedNames(names []string) []string {
+	sort.Strings(names)
+	return names
+}
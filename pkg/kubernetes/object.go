@@ -0,0 +1,92 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+)
+
+// WatchObject watches an arbitrary object and calls the eventHandler
+// (asyncronously) when an event happens. Event objects are of type
+// *unstructured.Unstructured. When the supplied context is canceled, watching
+// will stop.
+// If the object is namespaced and namespace is empty, defaultNamespace is
+// used. Returns an error immediately if the kind is unknown or the caller is
+// not allowed to read the object. Otherwise the returned channel receives nil
+// when watching stops because the context was canceled, or an error if
+// watching failed after retries.
+func WatchObject(ctx context.Context, dynamicClient dynamic.Interface, mapper meta.RESTMapper, gvk schema.GroupVersionKind, namespace, defaultNamespace, name string, eventHandler EventHandler) (<-chan error, error) {
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map kind to resource: %s: %v", gvk, err)
+	}
+
+	var client dynamic.ResourceInterface
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		namespace = ""
+		client = dynamicClient.Resource(mapping.Resource)
+	} else {
+		if namespace == "" {
+			namespace = defaultNamespace
+		}
+		client = dynamicClient.Resource(mapping.Resource).Namespace(namespace)
+	}
+
+	desc := objectDesc(mapping.Resource, namespace, name)
+
+	// Probe read access before watching, so that RBAC misconfiguration fails
+	// immediately with the required permissions, instead of after retries.
+	_, err = client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		if apierrors.IsForbidden(err) {
+			return nil, fmt.Errorf("forbidden: service account requires get, list, and watch permissions on %s: %v",
+				resourceDesc(mapping.Resource, namespace), err)
+		}
+		return nil, fmt.Errorf("failed to get %s: %v", desc, err)
+	}
+
+	// Watch doesn't take name matches, only selectors. So select on name.
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return client.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return client.Watch(ctx, options)
+		},
+	}
+
+	// Watch until canceled, even if deleted, because it may be recreated.
+	// Only the dynamic client reports whether it supports streaming lists,
+	// not the resource client.
+	return watchUntil(ctx, fmt.Sprintf("Object Watch(%s)", desc), lw, dynamicClient, &unstructured.Unstructured{}, false, eventHandler), nil
+}
+
+// objectDesc returns a human readable description of an object.
+func objectDesc(gvr schema.GroupVersionResource, namespace, name string) string {
+	if namespace == "" {
+		return fmt.Sprintf("%s/%s", gvr.GroupResource(), name)
+	}
+	return fmt.Sprintf("%s/%s/%s", gvr.GroupResource(), namespace, name)
+}
+
+// resourceDesc returns a human readable description of a resource type.
+func resourceDesc(gvr schema.GroupVersionResource, namespace string) string {
+	if namespace == "" {
+		return fmt.Sprintf("%s (cluster-scoped)", gvr.GroupResource())
+	}
+	return fmt.Sprintf("%s in namespace %s", gvr.GroupResource(), namespace)
+}
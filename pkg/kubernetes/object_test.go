@@ -0,0 +1,118 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var (
+	widgetGVK = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	widgetGVR = schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+)
+
+func newTestWidget(ready string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(widgetGVK)
+	obj.SetNamespace("ns")
+	obj.SetName("widget")
+	obj.Object["status"] = map[string]interface{}{
+		"conditions": []interface{}{
+			map[string]interface{}{"type": "Ready", "status": ready},
+		},
+	}
+	return obj
+}
+
+func newFakeDynamicClient(objects ...runtime.Object) (*dynamicfake.FakeDynamicClient, meta.RESTMapper) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{widgetGVR: "WidgetList"}, objects...)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(widgetGVK, meta.RESTScopeNamespace)
+	return client, mapper
+}
+
+// readyCondition returns the status of the Ready condition of the object.
+func readyCondition(obj runtime.Object) string {
+	conditions, _, _ := unstructured.NestedSlice(obj.(*unstructured.Unstructured).Object, "status", "conditions")
+	for _, c := range conditions {
+		cond := c.(map[string]interface{})
+		if cond["type"] == "Ready" {
+			return cond["status"].(string)
+		}
+	}
+	return ""
+}
+
+func TestWatchObjectConditionTrue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, mapper := newFakeDynamicClient(newTestWidget("False"))
+	events := make(chan watch.Event, 100)
+	resultCh, err := WatchObject(ctx, client, mapper, widgetGVK, "", "ns", "widget", func(event watch.Event) {
+		events <- event
+	})
+	if err != nil {
+		t.Fatalf("failed to watch object: %v", err)
+	}
+
+	waitForCondition := func(status string) {
+		t.Helper()
+		timeout := time.After(testTimeout)
+		for {
+			select {
+			case event := <-events:
+				if readyCondition(event.Object) == status {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for Ready=%s", status)
+			}
+		}
+	}
+	waitForCondition("False")
+
+	_, err = client.Resource(widgetGVR).Namespace("ns").Update(ctx, newTestWidget("True"), metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("failed to update object: %v", err)
+	}
+	waitForCondition("True")
+
+	cancel()
+	if err := waitForResult(t, resultCh); err != nil {
+		t.Errorf("expected nil result after cancel, got: %v", err)
+	}
+}
+
+func TestWatchObjectUnknownKind(t *testing.T) {
+	client, mapper := newFakeDynamicClient()
+	gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Gadget"}
+	_, err := WatchObject(context.Background(), client, mapper, gvk, "", "ns", "gadget", func(watch.Event) {})
+	if err == nil || !strings.Contains(err.Error(), "failed to map kind to resource") {
+		t.Errorf("expected mapping error, got: %v", err)
+	}
+}
+
+func TestWatchObjectForbidden(t *testing.T) {
+	client, mapper := newFakeDynamicClient()
+	client.PrependReactor("get", "widgets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(widgetGVR.GroupResource(), "widget", errors.New("not allowed"))
+	})
+	_, err := WatchObject(context.Background(), client, mapper, widgetGVK, "", "ns", "widget", func(watch.Event) {})
+	if err == nil || !strings.Contains(err.Error(), "requires get, list, and watch permissions on widgets.example.com in namespace ns") {
+		t.Errorf("expected forbidden error, got: %v", err)
+	}
+}
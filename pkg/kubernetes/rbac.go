@@ -0,0 +1,176 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Permission is a set of verbs on a resource.
+// The Resource may include a subresource, as in RBAC rules (ex: pods/status).
+// An empty Namespace means the resource is cluster-scoped.
+type Permission struct {
+	Group     string
+	Resource  string
+	Namespace string
+	Verbs     []string
+}
+
+func (p Permission) String() string {
+	resource := p.Resource
+	if p.Group != "" {
+		resource = fmt.Sprintf("%s.%s", p.Resource, p.Group)
+	}
+	if p.Namespace == "" {
+		return fmt.Sprintf("%s %s (cluster-scoped)", strings.Join(p.Verbs, ","), resource)
+	}
+	return fmt.Sprintf("%s %s in namespace %s", strings.Join(p.Verbs, ","), resource, p.Namespace)
+}
+
+// CheckPermissions uses SelfSubjectAccessReviews to check whether the client
+// has each of the permissions, and returns the missing ones, with only the
+// missing verbs.
+func CheckPermissions(ctx context.Context, clientset kubernetes.Interface, perms []Permission) ([]Permission, error) {
+	var missing []Permission
+	for _, perm := range perms {
+		resource, subresource, _ := strings.Cut(perm.Resource, "/")
+		var missingVerbs []string
+		for _, verb := range perm.Verbs {
+			review := &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Namespace:   perm.Namespace,
+						Verb:        verb,
+						Group:       perm.Group,
+						Resource:    resource,
+						Subresource: subresource,
+					},
+				},
+			}
+			result, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to review access: %v", err)
+			}
+			if !result.Status.Allowed {
+				missingVerbs = append(missingVerbs, verb)
+			}
+		}
+		if len(missingVerbs) > 0 {
+			missing = append(missing, Permission{
+				Group:     perm.Group,
+				Resource:  perm.Resource,
+				Namespace: perm.Namespace,
+				Verbs:     missingVerbs,
+			})
+		}
+	}
+	return missing, nil
+}
+
+// ServiceAccount returns the namespace and name of the service account the
+// client is authenticated as, using a SelfSubjectReview.
+// Returns an error if the client is not authenticated as a service account.
+func ServiceAccount(ctx context.Context, clientset kubernetes.Interface) (string, string, error) {
+	review, err := clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to review user: %v", err)
+	}
+	username := review.Status.UserInfo.Username
+	parts := strings.Split(username, ":")
+	if len(parts) != 4 || parts[0] != "system" || parts[1] != "serviceaccount" {
+		return "", "", fmt.Errorf("user is not a service account: %s", username)
+	}
+	return parts[2], parts[3], nil
+}
+
+// rbacMeta is the metadata of the generated RBAC objects.
+// ObjectMeta is not used, because it marshals a null creationTimestamp.
+type rbacMeta struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// rbacRole is a Role or ClusterRole.
+type rbacRole struct {
+	APIVersion string              `json:"apiVersion"`
+	Kind       string              `json:"kind"`
+	Metadata   rbacMeta            `json:"metadata"`
+	Rules      []rbacv1.PolicyRule `json:"rules"`
+}
+
+// rbacBinding is a RoleBinding or ClusterRoleBinding.
+type rbacBinding struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Metadata   rbacMeta         `json:"metadata"`
+	RoleRef    rbacv1.RoleRef   `json:"roleRef"`
+	Subjects   []rbacv1.Subject `json:"subjects"`
+}
+
+// RBACYAML returns the Role and RoleBinding (or ClusterRole and
+// ClusterRoleBinding, for cluster-scoped permissions) YAML that grants the
+// permissions to the service account.
+func RBACYAML(perms []Permission, saNamespace, saName, roleName string) (string, error) {
+	rulesByNamespace := map[string][]rbacv1.PolicyRule{}
+	for _, perm := range perms {
+		rulesByNamespace[perm.Namespace] = append(rulesByNamespace[perm.Namespace], rbacv1.PolicyRule{
+			APIGroups: []string{perm.Group},
+			Resources: []string{perm.Resource},
+			Verbs:     perm.Verbs,
+		})
+	}
+
+	namespaces := make([]string, 0, len(rulesByNamespace))
+	for namespace := range rulesByNamespace {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	subjects := []rbacv1.Subject{{
+		Kind:      rbacv1.ServiceAccountKind,
+		Name:      saName,
+		Namespace: saNamespace,
+	}}
+
+	var objs []interface{}
+	for _, namespace := range namespaces {
+		roleKind, bindingKind := "Role", "RoleBinding"
+		if namespace == "" {
+			roleKind, bindingKind = "ClusterRole", "ClusterRoleBinding"
+		}
+		meta := rbacMeta{Name: roleName, Namespace: namespace}
+		objs = append(objs,
+			&rbacRole{
+				APIVersion: rbacv1.SchemeGroupVersion.String(),
+				Kind:       roleKind,
+				Metadata:   meta,
+				Rules:      rulesByNamespace[namespace],
+			},
+			&rbacBinding{
+				APIVersion: rbacv1.SchemeGroupVersion.String(),
+				Kind:       bindingKind,
+				Metadata:   meta,
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: roleKind, Name: roleName},
+				Subjects:   subjects,
+			},
+		)
+	}
+
+	var docs []string
+	for _, obj := range objs {
+		doc, err := yaml.Marshal(obj)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal rbac yaml: %v", err)
+		}
+		docs = append(docs, string(doc))
+	}
+	return strings.Join(docs, "---\n"), nil
+}
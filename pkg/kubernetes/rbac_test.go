@@ -0,0 +1,112 @@
+package kubernetes
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCheckPermissionsSubresource(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		// allow everything except patching the pod status
+		allowed := !(attrs.Resource == "pods" && attrs.Subresource == "status" && attrs.Verb == "patch")
+		return true, &authorizationv1.SelfSubjectAccessReview{
+			Status: authorizationv1.SubjectAccessReviewStatus{Allowed: allowed},
+		}, nil
+	})
+
+	missing, err := CheckPermissions(context.Background(), clientset, []Permission{
+		{Resource: "pods", Namespace: "ns", Verbs: []string{"get", "patch"}},
+		{Resource: "pods/status", Namespace: "ns", Verbs: []string{"patch"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to check permissions: %v", err)
+	}
+	if len(missing) != 1 || missing[0].String() != "patch pods/status in namespace ns" {
+		t.Errorf("expected missing patch pods/status, got %v", missing)
+	}
+}
+
+func TestRBACYAML(t *testing.T) {
+	out, err := RBACYAML([]Permission{
+		{Resource: "pods", Namespace: "ns", Verbs: []string{"get", "patch"}},
+		{Resource: "pods/status", Namespace: "ns", Verbs: []string{"patch"}},
+		{Group: "example.com", Resource: "widgets", Verbs: []string{"get"}},
+	}, "ns", "sa", "kubexit")
+	if err != nil {
+		t.Fatalf("failed to generate yaml: %v", err)
+	}
+	expected := `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: kubexit
+rules:
+- apiGroups:
+  - example.com
+  resources:
+  - widgets
+  verbs:
+  - get
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: kubexit
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: kubexit
+subjects:
+- kind: ServiceAccount
+  name: sa
+  namespace: ns
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: kubexit
+  namespace: ns
+rules:
+- apiGroups:
+  - ""
+  resources:
+  - pods
+  verbs:
+  - get
+  - patch
+- apiGroups:
+  - ""
+  resources:
+  - pods/status
+  verbs:
+  - patch
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: kubexit
+  namespace: ns
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: kubexit
+subjects:
+- kind: ServiceAccount
+  name: sa
+  namespace: ns
+`
+	if out != expected {
+		t.Errorf("unexpected yaml:\n%s", out)
+	}
+	if strings.Contains(out, "creationTimestamp") {
+		t.Error("expected no creationTimestamp")
+	}
+}
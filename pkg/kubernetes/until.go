@@ -0,0 +1,152 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// ErrDeleted is sent on a watch result channel when the watched object was
+// deleted.
+var ErrDeleted = errors.New("deleted")
+
+// WatchBackoff is the exponential backoff used to retry List and Watch
+// errors. The backoff is reset when a Watch is established. When the steps
+// are exhausted, the last error is returned.
+// WatchPods and WatchServiceEndpoints retry with the informer's own backoff,
+// but also stop after Steps consecutive failures.
+var WatchBackoff = wait.Backoff{
+	Duration: 500 * time.Millisecond,
+	Factor:   2.0,
+	Jitter:   0.1,
+	Steps:    6,
+	Cap:      30 * time.Second,
+}
+
+// watchUntil calls the eventHandler with every event, using UntilWithSync to
+// List and then Watch, retrying with exponential backoff after List or Watch
+// errors.
+//
+// The returned channel receives exactly one value and is then closed:
+//   - nil, if the context was canceled
+//   - ErrDeleted, if stopOnDelete is true and the object was deleted
+//   - the last List or Watch error, if retries were exhausted
+func watchUntil(ctx context.Context, desc string, lw *cache.ListWatch, client any, objType runtime.Object, stopOnDelete bool, eventHandler EventHandler) <-chan error {
+	resultCh := make(chan error, 1)
+
+	go func() {
+		defer close(resultCh)
+
+		backoff := WatchBackoff
+		for {
+			deleted, watched, err := watchOnce(ctx, desc, lw, client, objType, stopOnDelete, eventHandler)
+			if ctx.Err() != nil {
+				// Cancellation is the normal way to stop watching.
+				log.Printf("%s: done\n", desc)
+				resultCh <- nil
+				return
+			}
+			if deleted {
+				log.Printf("%s: deleted\n", desc)
+				resultCh <- ErrDeleted
+				return
+			}
+
+			if watched {
+				// only consecutive failures count towards the limit
+				backoff = WatchBackoff
+			}
+			if backoff.Steps <= 1 {
+				log.Printf("%s: terminal error: %v\n", desc, err)
+				resultCh <- fmt.Errorf("%s: %v", desc, err)
+				return
+			}
+			delay := backoff.Step()
+			log.Printf("%s: error (retrying in %s): %v\n", desc, delay, err)
+			select {
+			case <-ctx.Done():
+				log.Printf("%s: done\n", desc)
+				resultCh <- nil
+				return
+			case <-time.After(delay):
+			}
+		}
+	}()
+
+	return resultCh
+}
+
+// watchOnce calls the eventHandler with every event, until the context is
+// canceled, the object is deleted (if stopOnDelete is true), or a List or
+// Watch fails. The informer behind UntilWithSync retries failed Lists and
+// Watches forever without reporting them, so the first error stops watching
+// and is returned instead. Returns whether the object was deleted, and
+// whether a Watch was established.
+func watchOnce(ctx context.Context, desc string, lw *cache.ListWatch, client any, objType runtime.Object, stopOnDelete bool, eventHandler EventHandler) (bool, bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var lock sync.Mutex
+	var watchErr error
+	watched := false
+	fail := func(err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if watchErr == nil {
+			watchErr = err
+		}
+		cancel()
+	}
+
+	failFastLW := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			obj, err := lw.ListFunc(options)
+			if err != nil {
+				fail(err)
+			}
+			return obj, err
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			w, err := lw.WatchFunc(options)
+			if err != nil {
+				fail(err)
+				return w, err
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			watched = true
+			return w, nil
+		},
+	}
+
+	_, err := watchtools.UntilWithSync(ctx, withWatchListSemantics(failFastLW, client), objType, nil, func(event watch.Event) (bool, error) {
+		if event.Type == watch.Error {
+			log.Printf("%s: recoverable error: %+v\n", desc, event.Object)
+			return false, nil
+		}
+
+		eventHandler(event)
+
+		if stopOnDelete && event.Type == watch.Deleted {
+			return true, nil
+		}
+		return false, nil
+	})
+
+	lock.Lock()
+	defer lock.Unlock()
+	if watchErr != nil {
+		return false, watched, watchErr
+	}
+	return err == nil, watched, err
+}
@@ -3,34 +3,24 @@ package kubernetes
 import (
 	"context"
 	"fmt"
-	"log"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
-	watchtools "k8s.io/client-go/tools/watch"
 )
 
 type EventHandler func(watch.Event)
 
 // Watch a pod and call the eventHandler (asyncronously) when an
 // event happens. When the supplied context is canceled, watching will stop.
-func WatchPod(ctx context.Context, namespace, podName string, eventHandler EventHandler) error {
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		return fmt.Errorf("failed to configure kubernetes client: %v", err)
-	}
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return fmt.Errorf("failed to create kubernetes client: %v", err)
-	}
-
+// The returned channel receives nil when watching stops because the context
+// was canceled, ErrDeleted if the pod was deleted, or an error if watching
+// failed after retries.
+func WatchPod(ctx context.Context, clientset kubernetes.Interface, namespace, podName string, eventHandler EventHandler) <-chan error {
 	// Watch doesn't take name matches, only selectors. So select on name.
 	fieldSelector := fields.OneTermEqualSelector("metadata.name", podName).String()
 
@@ -50,34 +40,15 @@ func WatchPod(ctx context.Context, namespace, podName string, eventHandler Event
 		},
 	}
 
-	go func() {
-		ctx, cancel := context.WithCancel(ctx)
-		// cancel the provided context when done, so that caller can block on it
-		defer cancel()
+	desc := fmt.Sprintf("Pod Watch(%s)", podName)
 
-		// watch until deleted
-		_, err := watchtools.UntilWithSync(ctx, lw, &corev1.Pod{}, nil, func(event watch.Event) (bool, error) {
-			if event.Type == watch.Error {
-				log.Printf("Pod Watch(%s): recoverable error: %+v\n", podName, event.Object)
-				return false, nil
-			}
-
-			eventHandler(event)
-
-			if event.Type == watch.Deleted {
-				log.Printf("Pod Watch(%s): pod deleted\n", podName)
-				return true, nil
-			}
-			return false, nil
-		})
-		// ErrWaitTimeout is returned when the context is canceled.
-		// Since cancellation is the only way we exit, just ignore it.
-		if err != nil && err != wait.ErrWaitTimeout {
-			// TODO: should we do something about this??
-			log.Printf("Pod Watch(%s): terminal error: %v\n", podName, err)
-		}
-		log.Printf("Pod Watch(%s): done\n", podName)
-	}()
+	// watch until deleted
+	return watchUntil(ctx, desc, lw, clientset, &corev1.Pod{}, true, eventHandler)
+}
 
-	return nil
+// withWatchListSemantics wraps the ListWatch so that the reflector falls back
+// to List and Watch if the client doesn't support streaming lists, like the
+// fake clients used in tests.
+func withWatchListSemantics(lw *cache.ListWatch, client any) cache.ListerWatcher {
+	return cache.ToListWatcherWithWatchListSemantics(lw, client)
 }
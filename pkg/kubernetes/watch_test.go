@@ -0,0 +1,205 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testTimeout = 10 * time.Second
+
+// newTestPod returns a pod with one container, ready or not.
+func newTestPod(ready bool) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", Ready: ready},
+			},
+		},
+	}
+}
+
+// newFakeClientset returns a fake clientset with the pod, and a channel that
+// receives a new FakeWatcher for every successful pod Watch. The first
+// `failures` calls to Watch return an error.
+func newFakeClientset(pod *corev1.Pod, failures int) (*fake.Clientset, <-chan *watch.FakeWatcher) {
+	clientset := fake.NewSimpleClientset(pod)
+	watchers := make(chan *watch.FakeWatcher, 10)
+	calls := 0
+	clientset.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		calls++
+		if calls <= failures {
+			return true, nil, errors.New("watch failed")
+		}
+		w := watch.NewFakeWithChanSize(10, false)
+		watchers <- w
+		return true, w, nil
+	})
+	return clientset, watchers
+}
+
+// nextWatcher returns the next FakeWatcher, or fails the test.
+func nextWatcher(t *testing.T, watchers <-chan *watch.FakeWatcher) *watch.FakeWatcher {
+	t.Helper()
+	select {
+	case w := <-watchers:
+		return w
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for watch")
+		return nil
+	}
+}
+
+// waitForEvent waits for an event of the type with a pod matching ready, or
+// fails the test.
+func waitForEvent(t *testing.T, events <-chan watch.Event, eventType watch.EventType, ready bool) {
+	t.Helper()
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case event := <-events:
+			pod, ok := event.Object.(*corev1.Pod)
+			if event.Type == eventType && ok && pod.Status.ContainerStatuses[0].Ready == ready {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s event with ready=%v", eventType, ready)
+		}
+	}
+}
+
+// waitForResult waits for the watch result, or fails the test.
+func waitForResult(t *testing.T, resultCh <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-resultCh:
+		return err
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for watch result")
+		return nil
+	}
+}
+
+func watchTestPod(ctx context.Context, clientset *fake.Clientset) (<-chan watch.Event, <-chan error) {
+	events := make(chan watch.Event, 100)
+	resultCh := WatchPod(ctx, clientset, "ns", "pod", func(event watch.Event) {
+		events <- event
+	})
+	return events, resultCh
+}
+
+func TestWatchPodReady(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clientset, watchers := newFakeClientset(newTestPod(false), 0)
+	events, resultCh := watchTestPod(ctx, clientset)
+
+	w := nextWatcher(t, watchers)
+	waitForEvent(t, events, watch.Added, false)
+
+	w.Modify(newTestPod(true))
+	waitForEvent(t, events, watch.Modified, true)
+
+	cancel()
+	if err := waitForResult(t, resultCh); err != nil {
+		t.Fatalf("expected nil after cancel, got: %v", err)
+	}
+}
+
+func TestWatchPodDeleted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pod := newTestPod(false)
+	clientset, watchers := newFakeClientset(pod, 0)
+	events, resultCh := watchTestPod(ctx, clientset)
+
+	w := nextWatcher(t, watchers)
+	w.Delete(pod)
+	waitForEvent(t, events, watch.Deleted, false)
+
+	if err := waitForResult(t, resultCh); err != ErrDeleted {
+		t.Fatalf("expected ErrDeleted, got: %v", err)
+	}
+}
+
+func TestWatchPodWatchErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The first Watch fails and the second receives an error event. Both
+	// are retried, so the third receives the ready pod.
+	clientset, watchers := newFakeClientset(newTestPod(false), 1)
+	events, resultCh := watchTestPod(ctx, clientset)
+
+	w := nextWatcher(t, watchers)
+	w.Error(&metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    500,
+		Reason:  metav1.StatusReasonInternalError,
+		Message: "watch broke",
+	})
+
+	w = nextWatcher(t, watchers)
+	w.Modify(newTestPod(true))
+	waitForEvent(t, events, watch.Modified, true)
+
+	cancel()
+	if err := waitForResult(t, resultCh); err != nil {
+		t.Fatalf("expected nil after cancel, got: %v", err)
+	}
+}
+
+func TestWatchPodTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	clientset, _ := newFakeClientset(newTestPod(false), 0)
+	_, resultCh := watchTestPod(ctx, clientset)
+
+	if err := waitForResult(t, resultCh); err != nil {
+		t.Fatalf("expected nil after timeout, got: %v", err)
+	}
+	if _, ok := <-resultCh; ok {
+		t.Fatal("expected result channel to be closed")
+	}
+}
+
+func TestWatchPodForbidden(t *testing.T) {
+	backoff := WatchBackoff
+	defer func() { WatchBackoff = backoff }()
+	WatchBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 2.0, Steps: 3}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clientset := fake.NewSimpleClientset(newTestPod(false))
+	lists := 0
+	clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		lists++
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", errors.New("not allowed"))
+	})
+	_, resultCh := watchTestPod(ctx, clientset)
+
+	err := waitForResult(t, resultCh)
+	if err == nil || !strings.Contains(err.Error(), "forbidden") {
+		t.Fatalf("expected forbidden error, got: %v", err)
+	}
+	if lists != 3 {
+		t.Errorf("expected 3 lists, got %d", lists)
+	}
+}
@@ -0,0 +1,345 @@
+package lint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/karlkfi/kubexit/pkg/birth"
+	"github.com/karlkfi/kubexit/pkg/inject"
+	"github.com/karlkfi/kubexit/pkg/supervisor"
+	"github.com/karlkfi/kubexit/pkg/tombstone"
+	"github.com/karlkfi/kubexit/pkg/topology"
+
+	"go.yaml.in/yaml/v3"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Finding is a problem found in a manifest, at a position in the file.
+type Finding struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", f.File, f.Line, f.Column, f.Message)
+}
+
+// envVar is a container env var.
+type envVar struct {
+	node  *yaml.Node
+	value string
+	// valueFrom is true if the value is not known statically
+	valueFrom bool
+}
+
+// container is a container in a pod spec, with the fields relevant to
+// kubexit.
+type container struct {
+	node         *yaml.Node
+	name         string
+	env          map[string]envVar
+	volumeMounts map[string]string
+}
+
+// wrapped returns true if the container is configured to run kubexit.
+func (c *container) wrapped() bool {
+	for name := range c.env {
+		if strings.HasPrefix(name, "KUBEXIT_") {
+			return true
+		}
+	}
+	command := scalars(c.node, "command")
+	return len(command) > 0 && path.Base(command[0]) == "kubexit"
+}
+
+// tombstoneName returns the name of the tombstones written by the container.
+func (c *container) tombstoneName() string {
+	if env, ok := c.env["KUBEXIT_NAME"]; ok && !env.valueFrom {
+		return env.value
+	}
+	return ""
+}
+
+// role returns the role of the container, or empty if it is not known.
+// Roles are case-insensitive.
+func (c *container) role() tombstone.Role {
+	if env, ok := c.env["KUBEXIT_ROLE"]; ok && !env.valueFrom {
+		role, _ := tombstone.ParseRole(env.value)
+		return role
+	}
+	return ""
+}
+
+// graveyard returns the graveyard path and the name of the volume mounted
+// there, if any. Returns an empty path if the graveyard is not known.
+func (c *container) graveyard() (string, string) {
+	graveyard := "/graveyard"
+	if env, ok := c.env["KUBEXIT_GRAVEYARD"]; ok {
+		if env.valueFrom {
+			return "", ""
+		}
+		graveyard = path.Clean(strings.TrimRight(env.value, "/"))
+	}
+	for volume, mountPath := range c.volumeMounts {
+		if path.Clean(mountPath) == graveyard {
+			return graveyard, volume
+		}
+	}
+	return graveyard, ""
+}
+
+// linter collects the findings for a file.
+type linter struct {
+	file     string
+	findings []Finding
+}
+
+func (l *linter) report(node *yaml.Node, format string, args ...interface{}) {
+	l.findings = append(l.findings, Finding{
+		File:    l.file,
+		Line:    node.Line,
+		Column:  node.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Lint statically analyses the multi-document YAML manifests for mistakes in
+// the kubexit configuration of pods and pod templates.
+// Documents of other kinds are ignored.
+// Returns the findings, sorted by position, or an error if the YAML is
+// invalid.
+func Lint(file string, r io.Reader) ([]Finding, error) {
+	l := &linter{file: file}
+	decoder := yaml.NewDecoder(r)
+	for {
+		doc := &yaml.Node{}
+		err := decoder.Decode(doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to parse yaml: %v", file, err)
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		l.lintObject(doc.Content[0])
+	}
+
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		if l.findings[i].Line != l.findings[j].Line {
+			return l.findings[i].Line < l.findings[j].Line
+		}
+		return l.findings[i].Column < l.findings[j].Column
+	})
+	return l.findings, nil
+}
+
+func (l *linter) lintObject(obj *yaml.Node) {
+	templatePath, ok := inject.PodTemplatePath(scalar(obj, "kind"))
+	if !ok {
+		return
+	}
+	template := obj
+	if len(templatePath) > 0 {
+		template = lookup(obj, templatePath...)
+	}
+	spec := lookup(template, "spec")
+	if spec == nil {
+		return
+	}
+
+	var containers []*container
+	for _, key := range []string{"initContainers", "containers"} {
+		for _, node := range items(spec, key) {
+			containers = append(containers, parseContainer(node))
+		}
+	}
+	l.lintContainers(containers)
+	l.lintAnnotations(template, spec)
+}
+
+func parseContainer(node *yaml.Node) *container {
+	c := &container{
+		node:         node,
+		name:         scalar(node, "name"),
+		env:          map[string]envVar{},
+		volumeMounts: map[string]string{},
+	}
+	for _, item := range items(node, "env") {
+		c.env[scalar(item, "name")] = envVar{
+			node:      item,
+			value:     scalar(item, "value"),
+			valueFrom: lookup(item, "valueFrom") != nil,
+		}
+	}
+	for _, item := range items(node, "volumeMounts") {
+		c.volumeMounts[scalar(item, "name")] = scalar(item, "mountPath")
+	}
+	return c
+}
+
+func (l *linter) lintContainers(containers []*container) {
+	byName := map[string]*container{}
+	byTombstone := map[string]*container{}
+	for _, c := range containers {
+		byName[c.name] = c
+		if c.wrapped() && c.tombstoneName() != "" {
+			byTombstone[c.tombstoneName()] = c
+		}
+	}
+
+	var primaries int
+	for _, c := range containers {
+		if c.wrapped() && c.role() == tombstone.RolePrimary {
+			primaries++
+		}
+	}
+
+	graph := map[string][]string{}
+	for _, c := range containers {
+		if !c.wrapped() {
+			continue
+		}
+
+		nameEnv, hasName := c.env["KUBEXIT_NAME"]
+		if !hasName {
+			l.report(c.node, "container %s: missing env var: KUBEXIT_NAME", c.name)
+		}
+
+		graveyard, graveyardVolume := c.graveyard()
+		if graveyard != "" && graveyardVolume == "" {
+			l.report(c.node, "container %s: missing graveyard volumeMount at %s", c.name, graveyard)
+		}
+
+		for _, key := range []string{"KUBEXIT_BIRTH_TIMEOUT", "KUBEXIT_BIRTH_STABILITY", "KUBEXIT_GRACE_PERIOD", "KUBEXIT_RESTART_BACKOFF", "KUBEXIT_MAX_RESTART_BACKOFF"} {
+			env, ok := c.env[key]
+			if !ok || env.valueFrom || env.value == "" {
+				continue
+			}
+			d, err := time.ParseDuration(env.value)
+			switch {
+			case err != nil:
+				l.report(env.node, "container %s: invalid %s: %v", c.name, key, err)
+			case d < 0:
+				l.report(env.node, "container %s: invalid %s: %s: must not be negative", c.name, key, env.value)
+			case d == 0 && key == "KUBEXIT_MAX_RESTART_BACKOFF":
+				l.report(env.node, "container %s: invalid %s: %s: must be positive", c.name, key, env.value)
+			}
+		}
+
+		if env, ok := c.env["KUBEXIT_RESTART_POLICY"]; ok && !env.valueFrom {
+			if _, err := supervisor.ParseRestart(env.value); err != nil {
+				l.report(env.node, "container %s: %v", c.name, err)
+			}
+		}
+
+		if env, ok := c.env["KUBEXIT_ROLE"]; ok && !env.valueFrom {
+			if _, err := tombstone.ParseRole(env.value); err != nil {
+				l.report(env.node, "container %s: %v", c.name, err)
+			}
+		}
+
+		if env, ok := c.env["KUBEXIT_PRIMARIES"]; ok {
+			if n, err := strconv.Atoi(env.value); !env.valueFrom && (err != nil || n < 1) {
+				l.report(env.node, "container %s: invalid KUBEXIT_PRIMARIES: %q: must be a positive integer", c.name, env.value)
+			}
+		} else if env, ok := c.env["KUBEXIT_ROLE"]; ok && c.role() == tombstone.RoleSidecar && primaries > 1 {
+			if _, ok := c.env["KUBEXIT_TOPOLOGY"]; !ok {
+				// the default is 1, so the sidecar may exit before the other
+				// primaries have written their tombstones
+				l.report(env.node, "container %s: sidecar may exit before every primary has started: set KUBEXIT_PRIMARIES=%d", c.name, primaries)
+			}
+		}
+
+		if env, ok := c.env["KUBEXIT_BIRTH_DEPS"]; ok && !env.valueFrom && env.value != "" {
+			if hasName && c.tombstoneName() != "" && c.tombstoneName() != c.name {
+				l.report(nameEnv.node, "container %s: KUBEXIT_NAME %q must match the container name when using birth deps", c.name, c.tombstoneName())
+			}
+			deps, err := birth.ParseDependencies(env.value)
+			if err != nil {
+				l.report(env.node, "container %s: invalid KUBEXIT_BIRTH_DEPS: %v", c.name, err)
+			}
+			for _, dep := range deps {
+				if dep.Kind != birth.KindContainer {
+					continue
+				}
+				if _, ok := byName[dep.Name]; !ok {
+					l.report(env.node, "container %s: unknown birth dep: %s", c.name, dep.Name)
+					continue
+				}
+				graph[c.name] = append(graph[c.name], dep.Name)
+			}
+		}
+
+		if env, ok := c.env["KUBEXIT_DEATH_DEPS"]; ok && !env.valueFrom && env.value != "" {
+			for _, dep := range strings.Split(env.value, ",") {
+				depContainer, ok := byTombstone[dep]
+				if !ok {
+					l.report(env.node, "container %s: unknown death dep: %s: no kubexit container has KUBEXIT_NAME=%s", c.name, dep, dep)
+					continue
+				}
+				_, depVolume := depContainer.graveyard()
+				if graveyardVolume != "" && depVolume != "" && depVolume != graveyardVolume {
+					l.report(env.node, "container %s: death dep %s uses graveyard volume %s, not %s", c.name, dep, depVolume, graveyardVolume)
+				}
+			}
+		}
+	}
+
+	if cycle := topology.FindCycle(graph); cycle != nil {
+		l.report(byName[cycle[0]].env["KUBEXIT_BIRTH_DEPS"].node, "birth dep cycle: %s", strings.Join(cycle, " -> "))
+	}
+}
+
+// lintAnnotations checks the deps annotations, used by `kubexit inject` and
+// `kubexit webhook`, by simulating injection.
+func (l *linter) lintAnnotations(template, spec *yaml.Node) {
+	annotations := stringMap(template, "metadata", "annotations")
+	deps, err := inject.DepsFromAnnotations(annotations)
+	if err == nil && len(deps) == 0 {
+		return
+	}
+	node := lookup(template, "metadata", "annotations")
+	if err != nil {
+		l.report(node, "%v", err)
+		return
+	}
+
+	podSpec, err := decodePodSpec(spec)
+	if err != nil {
+		l.report(spec, "invalid pod spec: %v", err)
+		return
+	}
+	_, err = inject.PodSpec(podSpec, annotations, inject.Config{})
+	if err != nil {
+		l.report(node, "%v", err)
+	}
+}
+
+func decodePodSpec(node *yaml.Node) (*corev1.PodSpec, error) {
+	var value interface{}
+	err := node.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	spec := &corev1.PodSpec{}
+	err = json.Unmarshal(data, spec)
+	if err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
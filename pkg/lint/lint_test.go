@@ -0,0 +1,273 @@
+package lint_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/karlkfi/kubexit/pkg/lint"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		expected []string
+	}{
+		{
+			name: "valid pod",
+			manifest: `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: app
+spec:
+  containers:
+  - name: app
+    env:
+    - name: KUBEXIT_NAME
+      value: app
+    - name: KUBEXIT_BIRTH_DEPS
+      value: proxy
+    volumeMounts:
+    - name: graveyard
+      mountPath: /graveyard
+  - name: proxy
+    env:
+    - name: KUBEXIT_NAME
+      value: proxy
+    - name: KUBEXIT_DEATH_DEPS
+      value: app
+    volumeMounts:
+    - name: graveyard
+      mountPath: /graveyard
+`,
+		},
+		{
+			name: "unwrapped containers are ignored",
+			manifest: `
+kind: Pod
+spec:
+  containers:
+  - name: app
+    env:
+    - name: OTHER
+      value: x
+`,
+		},
+		{
+			name: "missing name and graveyard",
+			manifest: `
+kind: Pod
+spec:
+  containers:
+  - name: app
+    command: [/kubexit/kubexit, ./app]
+`,
+			expected: []string{
+				"pod.yaml:5:5: container app: missing env var: KUBEXIT_NAME",
+				"pod.yaml:5:5: container app: missing graveyard volumeMount at /graveyard",
+			},
+		},
+		{
+			name: "invalid values",
+			manifest: `
+kind: Pod
+spec:
+  containers:
+  - name: app
+    env:
+    - name: KUBEXIT_NAME
+      value: app
+    - name: KUBEXIT_GRAVEYARD
+      value: /tombstones/
+    - name: KUBEXIT_GRACE_PERIOD
+      value: soon
+    - name: KUBEXIT_BIRTH_TIMEOUT
+      value: -1s
+    - name: KUBEXIT_ROLE
+      value: leader
+    volumeMounts:
+    - name: graveyard
+      mountPath: /tombstones
+`,
+			expected: []string{
+				`pod.yaml:11:7: container app: invalid KUBEXIT_GRACE_PERIOD: time: invalid duration "soon"`,
+				"pod.yaml:13:7: container app: invalid KUBEXIT_BIRTH_TIMEOUT: -1s: must not be negative",
+				`pod.yaml:15:7: container app: invalid role: "leader": expected primary or sidecar`,
+			},
+		},
+		{
+			name: "unknown deps",
+			manifest: `
+kind: Pod
+spec:
+  containers:
+  - name: app
+    env:
+    - name: KUBEXIT_NAME
+      value: app
+    - name: KUBEXIT_BIRTH_DEPS
+      value: db,service/api
+    - name: KUBEXIT_DEATH_DEPS
+      value: proxy
+    volumeMounts:
+    - name: graveyard
+      mountPath: /graveyard
+`,
+			expected: []string{
+				"pod.yaml:9:7: container app: unknown birth dep: db",
+				"pod.yaml:11:7: container app: unknown death dep: proxy: no kubexit container has KUBEXIT_NAME=proxy",
+			},
+		},
+		{
+			name: "multiple documents",
+			manifest: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: value
+---
+kind: Pod
+spec:
+  containers:
+  - name: app
+    env:
+    - name: KUBEXIT_NAME
+      value: app
+---
+kind: Pod
+spec:
+  containers:
+  - name: proxy
+    env:
+    - name: KUBEXIT_NAME
+      value: proxy
+`,
+			expected: []string{
+				"pod.yaml:12:5: container app: missing graveyard volumeMount at /graveyard",
+				"pod.yaml:20:5: container proxy: missing graveyard volumeMount at /graveyard",
+			},
+		},
+		{
+			name: "deployment template",
+			manifest: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        env:
+        - name: KUBEXIT_NAME
+          value: app
+        - name: KUBEXIT_BIRTH_DEPS
+          value: proxy
+        volumeMounts:
+        - name: graveyard
+          mountPath: /graveyard
+      - name: proxy
+        env:
+        - name: KUBEXIT_NAME
+          value: proxy
+        - name: KUBEXIT_BIRTH_DEPS
+          value: app
+        volumeMounts:
+        - name: graveyard
+          mountPath: /graveyard
+`,
+			expected: []string{
+				"pod.yaml:14:11: birth dep cycle: app -> proxy -> app",
+			},
+		},
+		{
+			name: "roles are case-insensitive",
+			manifest: `
+kind: Pod
+spec:
+  containers:
+  - name: app
+    env:
+    - name: KUBEXIT_NAME
+      value: app
+    - name: KUBEXIT_ROLE
+      value: Primary
+    volumeMounts:
+    - name: graveyard
+      mountPath: /graveyard
+  - name: worker
+    env:
+    - name: KUBEXIT_NAME
+      value: worker
+    - name: KUBEXIT_ROLE
+      value: primary
+    volumeMounts:
+    - name: graveyard
+      mountPath: /graveyard
+  - name: proxy
+    env:
+    - name: KUBEXIT_NAME
+      value: proxy
+    - name: KUBEXIT_ROLE
+      value: Sidecar
+    volumeMounts:
+    - name: graveyard
+      mountPath: /graveyard
+`,
+			expected: []string{
+				"pod.yaml:27:7: container proxy: sidecar may exit before every primary has started: set KUBEXIT_PRIMARIES=2",
+			},
+		},
+		{
+			name: "cronjob template",
+			manifest: `
+apiVersion: batch/v1
+kind: CronJob
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: job
+            env:
+            - name: KUBEXIT_NAME
+              value: job
+            - name: KUBEXIT_RESTART_POLICY
+              value: sometimes
+            volumeMounts:
+            - name: graveyard
+              mountPath: /graveyard
+`,
+			expected: []string{
+				`pod.yaml:14:15: container job: invalid restart policy: "sometimes": expected never, on-failure, or always`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := lint.Lint("pod.yaml", strings.NewReader(tt.manifest))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, finding := range findings {
+				got = append(got, finding.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("expected findings:\n%s\ngot:\n%s", strings.Join(tt.expected, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestLintInvalidYAML(t *testing.T) {
+	_, err := lint.Lint("pod.yaml", strings.NewReader("kind: Pod\nspec: [\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "pod.yaml: failed to parse yaml:") {
+		t.Fatalf("expected yaml error, got: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package lint
+
+import (
+	"go.yaml.in/yaml/v3"
+)
+
+// lookup returns the node at the path of mapping keys, or nil if not found.
+func lookup(node *yaml.Node, path ...string) *yaml.Node {
+	for _, key := range path {
+		node = mappingValue(node, key)
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// mappingValue returns the value of the key in a mapping node, or nil if not
+// found or not a mapping.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// scalar returns the value of the scalar at the path, or empty if not found.
+func scalar(node *yaml.Node, path ...string) string {
+	node = lookup(node, path...)
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+// items returns the items of the sequence at the path, or nil if not found.
+func items(node *yaml.Node, path ...string) []*yaml.Node {
+	node = lookup(node, path...)
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return node.Content
+}
+
+// scalars returns the values of the scalar items of the sequence at the path.
+func scalars(node *yaml.Node, path ...string) []string {
+	var values []string
+	for _, item := range items(node, path...) {
+		if item.Kind == yaml.ScalarNode {
+			values = append(values, item.Value)
+		}
+	}
+	return values
+}
+
+// stringMap returns the scalar values of the mapping at the path, by key.
+func stringMap(node *yaml.Node, path ...string) map[string]string {
+	node = lookup(node, path...)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	values := map[string]string{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i+1].Kind == yaml.ScalarNode {
+			values[node.Content[i].Value] = node.Content[i+1].Value
+		}
+	}
+	return values
+}
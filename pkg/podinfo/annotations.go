@@ -0,0 +1,195 @@
+package podinfo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/karlkfi/kubexit/pkg/birth"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// DepsAnnotationPrefix is the prefix of the pod annotations that configure
+	// the dependencies of a process. The process name is appended.
+	// Example: `kubexit.io/deps.server: death=client`
+	DepsAnnotationPrefix = "kubexit.io/deps."
+	// ShutdownAnnotationPrefix is the prefix of the pod annotations that
+	// request a graceful shutdown of a process at runtime, when set or
+	// changed to a non-empty value. The process name is appended.
+	// Example: `kubexit.io/shutdown.server: "2020-06-01T00:00:00Z"`
+	ShutdownAnnotationPrefix = "kubexit.io/shutdown."
+)
+
+// Deps are the dependencies of a process, configured by pod annotation.
+type Deps struct {
+	// Birth deps, comma separated
+	Birth string
+	// Death deps, comma separated
+	Death string
+}
+
+// ParseDeps parses a deps annotation value of the form
+// `birth=<deps>; death=<deps>`, where either key may be omitted.
+// Whitespace around keys and deps is ignored. Each key may be set once, and
+// each dep may be listed once. Birth deps must be valid birth dependencies,
+// and death deps must be container names.
+func ParseDeps(value string) (Deps, error) {
+	var deps Deps
+	seen := map[string]bool{}
+	for _, part := range strings.Split(value, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, depsStr, found := strings.Cut(part, "=")
+		if !found {
+			return Deps{}, fmt.Errorf("invalid deps annotation %q: expected <key>=<deps>", value)
+		}
+		key = strings.TrimSpace(key)
+		if seen[key] {
+			return Deps{}, fmt.Errorf("invalid deps annotation %q: duplicate key: %q", value, key)
+		}
+		seen[key] = true
+		var err error
+		switch key {
+		case "birth":
+			deps.Birth, err = parseDepList(depsStr, validateBirthDep)
+		case "death":
+			deps.Death, err = parseDepList(depsStr, validateDeathDep)
+		default:
+			return Deps{}, fmt.Errorf("invalid deps annotation %q: unknown key: %q", value, key)
+		}
+		if err != nil {
+			return Deps{}, fmt.Errorf("invalid deps annotation %q: %s: %v", value, key, err)
+		}
+	}
+	return deps, nil
+}
+
+// parseDepList validates a comma separated list of deps, and returns it
+// without surrounding whitespace.
+func parseDepList(value string, validate func(string) error) (string, error) {
+	deps := strings.Split(value, ",")
+	seen := map[string]bool{}
+	for i, dep := range deps {
+		dep = strings.TrimSpace(dep)
+		if dep == "" {
+			return "", fmt.Errorf("empty dep")
+		}
+		err := validate(dep)
+		if err != nil {
+			return "", err
+		}
+		if seen[dep] {
+			return "", fmt.Errorf("duplicate dep: %q", dep)
+		}
+		seen[dep] = true
+		deps[i] = dep
+	}
+	return strings.Join(deps, ","), nil
+}
+
+func validateBirthDep(dep string) error {
+	_, err := birth.ParseDependency(dep)
+	return err
+}
+
+// validateDeathDep checks that the death dep is a container name, because
+// death deps are read from tombstones in the graveyard.
+func validateDeathDep(dep string) error {
+	if errs := validation.IsDNS1123Label(dep); len(errs) > 0 {
+		return fmt.Errorf("invalid container name %q: %s", dep, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// ReadAnnotations reads a Downward API annotations file, with one
+// `key="escaped value"` annotation per line.
+func ReadAnnotations(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read annotations file: %v", err)
+	}
+	return ParseAnnotations(data)
+}
+
+// ParseAnnotations parses the content of a Downward API annotations file.
+// Lines are split on newlines without a length limit, because a single
+// annotation value can be as large as the 256KiB limit of all annotations.
+func ParseAnnotations(data []byte) (map[string]string, error) {
+	annotations := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, quoted, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid annotation line: %q", line)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation value: %s: %v", key, err)
+		}
+		annotations[key] = value
+	}
+	return annotations, nil
+}
+
+// AnnotationsHandler is called with the current annotations.
+type AnnotationsHandler func(map[string]string)
+
+// WatchAnnotations watches a Downward API annotations file and calls the
+// handler (asyncronously) with the annotations whenever the file changes.
+// The parent directory is watched, because the kubelet updates Downward API
+// volumes by atomically swapping a symlink, not by writing to the file.
+// When the supplied context is canceled, watching will stop.
+func WatchAnnotations(ctx context.Context, path string, handler AnnotationsHandler) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %v", err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Printf("Annotations Watch(%s): done\n", path)
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+					// ignore other events
+					continue
+				}
+				annotations, err := ReadAnnotations(path)
+				if err != nil {
+					log.Printf("Annotations Watch(%s): error: %v\n", path, err)
+					continue
+				}
+				handler(annotations)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Annotations Watch(%s): error: %v\n", path, err)
+			}
+		}
+	}()
+
+	err = watcher.Add(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("failed to add watcher: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package podinfo
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseAnnotations(t *testing.T) {
+	data := []byte(`kubexit.io/birth-deps="db,cache"
+kubexit.io/death-deps=""
+multiline="line one\nline two"
+`)
+	annotations, err := ParseAnnotations(data)
+	if err != nil {
+		t.Fatalf("failed to parse annotations: %v", err)
+	}
+	expected := map[string]string{
+		"kubexit.io/birth-deps": "db,cache",
+		"kubexit.io/death-deps": "",
+		"multiline":             "line one\nline two",
+	}
+	if len(annotations) != len(expected) {
+		t.Fatalf("expected %d annotations, got %d: %v", len(expected), len(annotations), annotations)
+	}
+	for key, value := range expected {
+		if annotations[key] != value {
+			t.Errorf("annotation %s: expected %q, got %q", key, value, annotations[key])
+		}
+	}
+}
+
+func TestParseAnnotationsLongValue(t *testing.T) {
+	// longer than the default bufio.Scanner token limit of 64KiB
+	long := strings.Repeat("x", 200<<10)
+	annotations, err := ParseAnnotations([]byte("long=" + strconv.Quote(long) + "\n"))
+	if err != nil {
+		t.Fatalf("failed to parse annotations: %v", err)
+	}
+	if annotations["long"] != long {
+		t.Errorf("expected %d byte value, got %d bytes", len(long), len(annotations["long"]))
+	}
+}
+
+func TestParseAnnotationsInvalid(t *testing.T) {
+	for _, data := range []string{"novalue\n", "key=unquoted\n"} {
+		if _, err := ParseAnnotations([]byte(data)); err == nil {
+			t.Errorf("expected error for %q", data)
+		}
+	}
+}
+
+func TestParseDeps(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected Deps
+		err      string
+	}{
+		{
+			name:     "birth and death",
+			value:    "birth=db,cache;death=client",
+			expected: Deps{Birth: "db,cache", Death: "client"},
+		},
+		{
+			name:     "whitespace",
+			value:    "  birth = db , cache ;\n death=client  ",
+			expected: Deps{Birth: "db,cache", Death: "client"},
+		},
+		{
+			name:     "birth dep kinds",
+			value:    "birth=migrate:succeeded, service/db:2, pods/app=cache",
+			expected: Deps{Birth: "migrate:succeeded,service/db:2,pods/app=cache"},
+		},
+		{
+			name:     "empty entries",
+			value:    ";death=client;;",
+			expected: Deps{Death: "client"},
+		},
+		{
+			name:  "empty",
+			value: " ",
+		},
+		{
+			name:  "missing equals",
+			value: "death",
+			err:   "expected <key>=<deps>",
+		},
+		{
+			name:  "unknown key",
+			value: "life=client",
+			err:   `unknown key: "life"`,
+		},
+		{
+			name:  "duplicate key",
+			value: "death=client; death=server",
+			err:   `duplicate key: "death"`,
+		},
+		{
+			name:  "empty value",
+			value: "birth=",
+			err:   "birth: empty dep",
+		},
+		{
+			name:  "empty dep",
+			value: "birth=db,,cache",
+			err:   "birth: empty dep",
+		},
+		{
+			name:  "trailing comma",
+			value: "death=client,",
+			err:   "death: empty dep",
+		},
+		{
+			name:  "duplicate dep",
+			value: "birth=db, db",
+			err:   `birth: duplicate dep: "db"`,
+		},
+		{
+			name:  "invalid birth dep",
+			value: "birth=migrate:finished",
+			err:   `birth: invalid birth dependency "migrate:finished": unknown condition`,
+		},
+		{
+			name:  "invalid death dep name",
+			value: "death=Client_1",
+			err:   `death: invalid container name "Client_1"`,
+		},
+		{
+			name:  "space in death dep name",
+			value: "death=my client",
+			err:   `death: invalid container name "my client"`,
+		},
+		{
+			name:  "death dep with condition",
+			value: "death=client:ready",
+			err:   `death: invalid container name "client:ready"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deps, err := ParseDeps(tt.value)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse deps: %v", err)
+			}
+			if deps != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, deps)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package processes
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/karlkfi/kubexit/pkg/birth"
+	"github.com/karlkfi/kubexit/pkg/topology"
+	"sigs.k8s.io/yaml"
+)
+
+// Spec describes multiple processes to supervise in a single container.
+type Spec struct {
+	// Primary is the name of the process whose exit ends the container.
+	// When it exits, the other processes are gracefully terminated.
+	Primary   string             `json:"primary"`
+	Processes map[string]Process `json:"processes"`
+}
+
+// Process is a command with the same dependencies and durations as a
+// topology process. Birth deps name other processes in the same spec, and
+// are met when the process is started (or, with a `completed` or
+// `succeeded` condition, has exited).
+// Death deps may name any tombstone in the graveyard.
+type Process struct {
+	topology.Process
+	Command []string `json:"command"`
+
+	// RestartPolicy is `never` (default), `on-failure`, or `always`, with
+	// the same limits and backoff as KUBEXIT_RESTART_POLICY.
+	RestartPolicy     string `json:"restartPolicy,omitempty"`
+	MaxRestarts       int    `json:"maxRestarts,omitempty"`
+	RestartBackoff    string `json:"restartBackoff,omitempty"`
+	MaxRestartBackoff string `json:"maxRestartBackoff,omitempty"`
+}
+
+// Read reads a spec file. Files with a `.yaml`, `.yml`, or `.json` extension
+// are parsed as YAML, and other files are parsed as a Procfile.
+func Read(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read processes file: %v", err)
+	}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml", ".json":
+		return ParseYAML(data)
+	default:
+		return ParseProcfile(data)
+	}
+}
+
+// ParseYAML parses spec YAML.
+func ParseYAML(data []byte) (*Spec, error) {
+	s := &Spec{}
+	err := yaml.UnmarshalStrict(data, s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal processes yaml: %v", err)
+	}
+	return s, nil
+}
+
+// ParseProcfile parses a Procfile, with one `<name>: <command>` process per
+// line. Commands are run with `sh -c`. Empty lines and lines starting with
+// `#` are ignored. The first process is the primary.
+func ParseProcfile(data []byte) (*Spec, error) {
+	s := &Spec{Processes: map[string]Process{}}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, command, found := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		command = strings.TrimSpace(command)
+		if !found || name == "" || command == "" {
+			return nil, fmt.Errorf("invalid Procfile line %d: expected <name>: <command>", lineNum)
+		}
+		if _, ok := s.Processes[name]; ok {
+			return nil, fmt.Errorf("invalid Procfile line %d: duplicate process: %s", lineNum, name)
+		}
+		s.Processes[name] = Process{Command: []string{"sh", "-c", command}}
+		if s.Primary == "" {
+			s.Primary = name
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse Procfile: %v", err)
+	}
+	return s, nil
+}
+
+// Merge sets the dependencies and durations of each process from the
+// topology process with the same name, unless already set in the spec.
+func (s *Spec) Merge(t *topology.Topology) {
+	for name, proc := range s.Processes {
+		other, ok := t.Processes[name]
+		if !ok {
+			continue
+		}
+		if len(proc.BirthDeps) == 0 {
+			proc.BirthDeps = other.BirthDeps
+		}
+		if proc.BirthTimeout == "" {
+			proc.BirthTimeout = other.BirthTimeout
+		}
+		if proc.BirthStability == "" {
+			proc.BirthStability = other.BirthStability
+		}
+		if len(proc.DeathDeps) == 0 {
+			proc.DeathDeps = other.DeathDeps
+		}
+		if proc.GracePeriod == "" {
+			proc.GracePeriod = other.GracePeriod
+		}
+		if proc.Role == "" {
+			proc.Role = other.Role
+		}
+		if proc.FateGroup == "" {
+			proc.FateGroup = other.FateGroup
+		}
+		s.Processes[name] = proc
+	}
+}
+
+// Validate checks the primary, the commands, and the birth deps, which must
+// name other processes in the spec and must not form a cycle.
+func (s *Spec) Validate() error {
+	var errs []string
+	if len(s.Processes) == 0 {
+		errs = append(errs, "no processes")
+	}
+	if _, ok := s.Processes[s.Primary]; !ok {
+		errs = append(errs, fmt.Sprintf("unknown primary process: %q", s.Primary))
+	}
+
+	// Death deps may name tombstones of other containers, so only the birth
+	// deps are validated as a topology.
+	t := &topology.Topology{Processes: map[string]topology.Process{}}
+	for _, name := range s.Names() {
+		proc := s.Processes[name]
+		if len(proc.Command) == 0 {
+			errs = append(errs, fmt.Sprintf("process %s: missing command", name))
+		}
+		if proc.Probes != nil {
+			errs = append(errs, fmt.Sprintf("process %s: probes are not supported: processes are ready when started", name))
+		}
+		for _, depStr := range proc.BirthDeps {
+			dep, err := birth.ParseDependency(depStr)
+			if err == nil && dep.Kind != birth.KindContainer {
+				errs = append(errs, fmt.Sprintf("process %s: unsupported birth dep: %s: only other processes are supported", name, depStr))
+			}
+		}
+		birthOnly := proc.Process
+		birthOnly.DeathDeps = nil
+		t.Processes[name] = birthOnly
+	}
+	if err := t.Validate(); err != nil {
+		// flatten the topology errors into the process errors
+		msg := strings.TrimPrefix(err.Error(), "invalid topology:\n- ")
+		errs = append(errs, strings.Split(msg, "\n- ")...)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid processes:\n- %s", strings.Join(errs, "\n- "))
+	}
+	return nil
+}
+
+// Names returns the process names, sorted.
+func (s *Spec) Names() []string {
+	names := make([]string, 0, len(s.Processes))
+	for name := range s.Processes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,262 @@
+package processes_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/karlkfi/kubexit/pkg/processes"
+	"github.com/karlkfi/kubexit/pkg/topology"
+)
+
+func TestParseProcfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		procfile string
+		primary  string
+		commands map[string][]string
+		err      string
+	}{
+		{
+			name:     "processes",
+			procfile: "web: ./server --port 8080\nworker:./worker\n",
+			primary:  "web",
+			commands: map[string][]string{
+				"web":    {"sh", "-c", "./server --port 8080"},
+				"worker": {"sh", "-c", "./worker"},
+			},
+		},
+		{
+			name:     "comments and blank lines",
+			procfile: "# processes\n\n  \nweb: ./server\n  # worker: ./worker\n",
+			primary:  "web",
+			commands: map[string][]string{
+				"web": {"sh", "-c", "./server"},
+			},
+		},
+		{
+			name:     "command with colon",
+			procfile: "web: echo a:b\n",
+			primary:  "web",
+			commands: map[string][]string{
+				"web": {"sh", "-c", "echo a:b"},
+			},
+		},
+		{
+			name:     "missing colon",
+			procfile: "web: ./server\nworker ./worker\n",
+			err:      "invalid Procfile line 2: expected <name>: <command>",
+		},
+		{
+			name:     "missing name",
+			procfile: ": ./server\n",
+			err:      "invalid Procfile line 1: expected <name>: <command>",
+		},
+		{
+			name:     "missing command",
+			procfile: "web:\n",
+			err:      "invalid Procfile line 1: expected <name>: <command>",
+		},
+		{
+			name:     "duplicate process",
+			procfile: "web: ./server\nweb: ./other\n",
+			err:      "invalid Procfile line 2: duplicate process: web",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := processes.ParseProcfile([]byte(tt.procfile))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if spec.Primary != tt.primary {
+				t.Errorf("expected primary %q, got %q", tt.primary, spec.Primary)
+			}
+			commands := map[string][]string{}
+			for name, proc := range spec.Processes {
+				commands[name] = proc.Command
+			}
+			if !reflect.DeepEqual(commands, tt.commands) {
+				t.Errorf("expected commands %q, got %q", tt.commands, commands)
+			}
+		})
+	}
+}
+
+func TestParseYAMLDuplicate(t *testing.T) {
+	_, err := processes.ParseYAML([]byte(`
+primary: web
+processes:
+  web:
+    command: [./server]
+  web:
+    command: [./other]
+`))
+	if err == nil || !strings.Contains(err.Error(), "already set") {
+		t.Fatalf("expected duplicate key error, got: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		errs []string
+	}{
+		{
+			name: "valid",
+			spec: `
+primary: web
+processes:
+  web:
+    command: [./server]
+    birthDeps: [proxy:started]
+  proxy:
+    command: [./proxy]
+    deathDeps: [other-container]
+`,
+		},
+		{
+			name: "no processes",
+			spec: `primary: web`,
+			errs: []string{"no processes", `unknown primary process: "web"`},
+		},
+		{
+			name: "unknown primary",
+			spec: `
+primary: api
+processes:
+  web:
+    command: [./server]
+`,
+			errs: []string{`unknown primary process: "api"`},
+		},
+		{
+			name: "empty command",
+			spec: `
+primary: web
+processes:
+  web:
+    command: []
+`,
+			errs: []string{"process web: missing command"},
+		},
+		{
+			name: "probes",
+			spec: `
+primary: web
+processes:
+  web:
+    command: [./server]
+    probes:
+      readiness:
+        tcpSocket:
+          port: 8080
+`,
+			errs: []string{"process web: probes are not supported: processes are ready when started"},
+		},
+		{
+			name: "unknown birth dep",
+			spec: `
+primary: web
+processes:
+  web:
+    command: [./server]
+    birthDeps: [proxy]
+`,
+			errs: []string{"process web: unknown birth dep: proxy"},
+		},
+		{
+			name: "unsupported birth dep",
+			spec: `
+primary: web
+processes:
+  web:
+    command: [./server]
+    birthDeps: [service/db]
+`,
+			errs: []string{"process web: unsupported birth dep: service/db: only other processes are supported"},
+		},
+		{
+			name: "birth dep cycle",
+			spec: `
+primary: web
+processes:
+  web:
+    command: [./server]
+    birthDeps: [proxy]
+  proxy:
+    command: [./proxy]
+    birthDeps: [web]
+`,
+			errs: []string{"birth dep cycle: proxy -> web -> proxy"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := processes.ParseYAML([]byte(tt.spec))
+			if err != nil {
+				t.Fatalf("failed to parse spec: %v", err)
+			}
+			err = spec.Validate()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			expected := "invalid processes:\n- " + strings.Join(tt.errs, "\n- ")
+			if err == nil || err.Error() != expected {
+				t.Fatalf("expected error:\n%s\ngot:\n%v", expected, err)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	spec, err := processes.ParseYAML([]byte(`
+primary: web
+processes:
+  web:
+    command: [./server]
+    gracePeriod: 5s
+  worker:
+    command: [./worker]
+`))
+	if err != nil {
+		t.Fatalf("failed to parse spec: %v", err)
+	}
+	spec.Merge(&topology.Topology{Processes: map[string]topology.Process{
+		"web": {
+			BirthDeps:   []string{"worker"},
+			GracePeriod: "30s",
+			Role:        "primary",
+		},
+		"other": {
+			GracePeriod: "1s",
+		},
+	}})
+
+	web := spec.Processes["web"]
+	if !reflect.DeepEqual(web.BirthDeps, []string{"worker"}) {
+		t.Errorf("expected birth deps from topology, got %q", web.BirthDeps)
+	}
+	if web.GracePeriod != "5s" {
+		t.Errorf("expected grace period from spec, got %q", web.GracePeriod)
+	}
+	if web.Role != "primary" {
+		t.Errorf("expected role from topology, got %q", web.Role)
+	}
+	if worker := spec.Processes["worker"]; !reflect.DeepEqual(worker.Process, topology.Process{}) {
+		t.Errorf("expected worker without topology to be unchanged, got %+v", worker.Process)
+	}
+	if _, ok := spec.Processes["other"]; ok {
+		t.Error("expected topology process without command to be ignored")
+	}
+}
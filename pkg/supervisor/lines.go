@@ -0,0 +1,67 @@
+package supervisor
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// maxPartialLine is the maximum length of an incomplete line to buffer.
+// Longer lines are split, so that output without newlines doesn't grow the
+// buffer without bound. Lines are split before a UTF-8 rune that would cross
+// the limit.
+const maxPartialLine = 4 << 10
+
+// lineBuffer splits written bytes into lines, buffering the incomplete last
+// line until the next write. Not safe for concurrent use.
+type lineBuffer struct {
+	partial []byte
+}
+
+// write calls writeLine with each complete line, without the newline.
+// Stops at the first error.
+func (b *lineBuffer) write(p []byte, writeLine func([]byte) error) error {
+	data := append(b.partial, p...)
+	for {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			break
+		}
+		err := writeLine(data[:idx])
+		if err != nil {
+			return err
+		}
+		data = data[idx+1:]
+	}
+	for len(data) > maxPartialLine {
+		cut := runeBoundary(data, maxPartialLine)
+		err := writeLine(data[:cut])
+		if err != nil {
+			return err
+		}
+		data = data[cut:]
+	}
+	// copy, so that the next write doesn't alias the old buffer
+	b.partial = append([]byte(nil), data...)
+	return nil
+}
+
+// flush calls writeLine with the incomplete last line, if any.
+func (b *lineBuffer) flush(writeLine func([]byte) error) error {
+	if len(b.partial) == 0 {
+		return nil
+	}
+	line := b.partial
+	b.partial = nil
+	return writeLine(line)
+}
+
+// runeBoundary returns the largest offset, no greater than n, that doesn't
+// split a UTF-8 rune, or n if there is none, because the data isn't UTF-8.
+func runeBoundary(data []byte, n int) int {
+	for i := n; i > n-utf8.UTFMax && i > 0; i-- {
+		if utf8.RuneStart(data[i]) {
+			return i
+		}
+	}
+	return n
+}
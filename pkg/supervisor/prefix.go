@@ -0,0 +1,46 @@
+package supervisor
+
+import (
+	"io"
+	"sync"
+)
+
+// prefixWriter writes each complete line to the underlying writer with a
+// prefix, so that the output of multiple child processes can be told apart.
+type prefixWriter struct {
+	lock   sync.Mutex
+	w      io.Writer
+	prefix []byte
+	lines  lineBuffer
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{w: w, prefix: []byte(prefix)}
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	err := w.lines.write(p, w.writeLine)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes the incomplete last line, if any, with a newline.
+func (w *prefixWriter) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.lines.flush(w.writeLine)
+}
+
+// writeLine writes the prefix, line, and newline in one write, so that lines
+// from concurrent writers are not interleaved.
+func (w *prefixWriter) writeLine(line []byte) error {
+	buf := make([]byte, 0, len(w.prefix)+len(line)+1)
+	buf = append(append(append(buf, w.prefix...), line...), '\n')
+	_, err := w.w.Write(buf)
+	return err
+}
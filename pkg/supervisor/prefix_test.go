@@ -0,0 +1,43 @@
+package supervisor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := newPrefixWriter(&out, "[app] ")
+
+	w.Write([]byte("one\ntw"))
+	w.Write([]byte("o\nthr"))
+	if err := w.Flush(); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+
+	expected := "[app] one\n[app] two\n[app] thr\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestPrefixWriterLongLine(t *testing.T) {
+	var out bytes.Buffer
+	w := newPrefixWriter(&out, "> ")
+
+	long := strings.Repeat("x", maxPartialLine)
+	w.Write([]byte(long + "x"))
+	if len(w.lines.partial) != 1 {
+		t.Errorf("expected 1 byte partial line, got %d bytes", len(w.lines.partial))
+	}
+	w.Write([]byte("y\n"))
+
+	expected := "> " + long + "\n> xy\n"
+	if out.String() != expected {
+		t.Errorf("expected long line to be split at %d bytes, got %d bytes", maxPartialLine, out.Len())
+	}
+	if len(w.lines.partial) != 0 {
+		t.Errorf("expected empty partial line, got %d bytes", len(w.lines.partial))
+	}
+}
@@ -0,0 +1,105 @@
+package supervisor
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Restart decides which exits of the child process are followed by a
+// restart.
+type Restart string
+
+const (
+	// RestartNever never restarts the child process.
+	RestartNever Restart = "never"
+	// RestartOnFailure restarts the child process if it exits non-zero.
+	RestartOnFailure Restart = "on-failure"
+	// RestartAlways restarts the child process whenever it exits.
+	RestartAlways Restart = "always"
+)
+
+// ParseRestart parses a restart policy. Empty is never.
+func ParseRestart(s string) (Restart, error) {
+	switch r := Restart(strings.ToLower(s)); r {
+	case "":
+		return RestartNever, nil
+	case RestartNever, RestartOnFailure, RestartAlways:
+		return r, nil
+	default:
+		return "", fmt.Errorf("invalid restart policy: %q: expected %s, %s, or %s", s, RestartNever, RestartOnFailure, RestartAlways)
+	}
+}
+
+// RestartPolicy configures in-process restarts of the child process.
+type RestartPolicy struct {
+	Restart Restart
+	// MaxRestarts is the maximum number of restarts. Zero is unlimited.
+	// Restarts are counted for the lifetime of the supervisor, and never
+	// reset.
+	MaxRestarts int
+	// Backoff is the delay before the first restart, doubled for each
+	// following restart, up to MaxBackoff. Delays are jittered by up to half,
+	// so that processes that crashed together don't restart together.
+	// If MaxBackoff is not greater than Backoff, the delay never grows.
+	// The delay is reset to Backoff when the child process ran for longer
+	// than MaxBackoff before exiting.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// shouldRestart returns true if the policy restarts the child process after
+// it exited with the error, after the specified number of restarts.
+func (p RestartPolicy) shouldRestart(restarts int, exitErr error) bool {
+	if p.MaxRestarts > 0 && restarts >= p.MaxRestarts {
+		return false
+	}
+	switch p.Restart {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return exitErr != nil
+	default:
+		return false
+	}
+}
+
+// delay returns the jittered backoff delay before the next restart, after
+// the specified number of restarts since the backoff was reset.
+func (p RestartPolicy) delay(restarts int) time.Duration {
+	d := p.Backoff
+	for i := 0; i < restarts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = max(p.MaxBackoff, p.Backoff)
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// RestartHook is called before the child process is restarted, with the
+// number of restarts so far (including this one), the exit code, and the
+// backoff delay.
+type RestartHook func(restarts int, exitCode int, delay time.Duration)
+
+// RestartedHook is called after the child process is restarted, with the
+// number of restarts so far.
+type RestartedHook func(restarts int)
+
+// ExitCode returns the exit code of a child process from the error returned
+// by Wait: 0 if nil, or -1 if unknown.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ProcessState.ExitCode()
+	}
+	return -1
+}
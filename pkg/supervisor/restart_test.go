@@ -0,0 +1,53 @@
+package supervisor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRestartDelay(t *testing.T) {
+	policy := RestartPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for restarts, expected := range []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second,
+	} {
+		for i := 0; i < 10; i++ {
+			delay := policy.delay(restarts)
+			if delay < expected/2 || delay > expected {
+				t.Fatalf("restart %d: expected delay between %s and %s, got %s", restarts, expected/2, expected, delay)
+			}
+		}
+	}
+}
+
+func TestRestartDelayMaxBelowBackoff(t *testing.T) {
+	policy := RestartPolicy{Backoff: 2 * time.Second, MaxBackoff: time.Second}
+	if delay := policy.delay(3); delay < time.Second || delay > 2*time.Second {
+		t.Fatalf("expected delay between 1s and 2s, got %s", delay)
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	failed := &testError{}
+	tests := []struct {
+		policy   RestartPolicy
+		restarts int
+		err      error
+		expected bool
+	}{
+		{RestartPolicy{Restart: RestartNever}, 0, failed, false},
+		{RestartPolicy{Restart: RestartOnFailure}, 0, failed, true},
+		{RestartPolicy{Restart: RestartOnFailure}, 0, nil, false},
+		{RestartPolicy{Restart: RestartAlways}, 0, nil, true},
+		{RestartPolicy{Restart: RestartAlways, MaxRestarts: 2}, 1, nil, true},
+		{RestartPolicy{Restart: RestartAlways, MaxRestarts: 2}, 2, nil, false},
+	}
+	for _, tc := range tests {
+		if actual := tc.policy.shouldRestart(tc.restarts, tc.err); actual != tc.expected {
+			t.Errorf("%+v after %d restarts with error %v: expected %v, got %v", tc.policy, tc.restarts, tc.err, tc.expected, actual)
+		}
+	}
+}
+
+type testError struct{}
+
+func (e *testError) Error() string { return "failed" }
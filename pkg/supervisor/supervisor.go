@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -14,11 +15,36 @@ import (
 	"time"
 )
 
+// outputWaitDelay is the maximum time to wait for output to be copied after
+// the child process exits. Output that isn't written directly to a file is
+// copied through pipes, which stay open while orphaned grandchildren are
+// still running, so don't wait for them.
+const outputWaitDelay = time.Second
+
+// ShutdownHook is called when the supervisor sends a shutdown signal
+// (SIGTERM or SIGKILL) to the child process, or propagates a SIGTERM or
+// SIGINT received by the supervisor.
+type ShutdownHook func(sig os.Signal)
+
 type Supervisor struct {
-	cmd           *exec.Cmd
-	sigCh         chan os.Signal
-	startStopLock sync.Mutex
-	shutdownTimer *time.Timer
+	cmd            *exec.Cmd
+	sigCh          chan os.Signal
+	startStopLock  sync.Mutex
+	shutdownTimer  *time.Timer
+	shutdownHooks  []ShutdownHook
+	outputTail     *tail
+	prefixWriters  []*prefixWriter
+	restartPolicy  RestartPolicy
+	restartHooks   []RestartHook
+	restartedHooks []RestartedHook
+	restarts       int
+	// backoffSteps is the number of restarts since the backoff was reset
+	backoffSteps int
+	// started is when the child process was last started
+	started time.Time
+	// stopCh is closed when shutdown is requested, to stop restarts
+	stopCh   chan struct{}
+	stopOnce sync.Once
 }
 
 func New(name string, args ...string) *Supervisor {
@@ -31,8 +57,67 @@ func New(name string, args ...string) *Supervisor {
 	cmd.Stderr = os.Stderr
 	cmd.Env = os.Environ()
 	return &Supervisor{
-		cmd: cmd,
+		cmd:    cmd,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// OnShutdown adds a hook to call when a shutdown signal is sent to the child
+// process. Hooks are called in the order added. Must be called before Start.
+func (s *Supervisor) OnShutdown(hook ShutdownHook) {
+	s.shutdownHooks = append(s.shutdownHooks, hook)
+}
+
+// TailOutput keeps the last lines of the child process stdout and stderr,
+// combined, in memory. Must be called before Start.
+func (s *Supervisor) TailOutput(lines int) {
+	if lines <= 0 {
+		return
+	}
+	s.outputTail = newTail(lines)
+	s.cmd.Stdout = io.MultiWriter(os.Stdout, s.outputTail.Writer())
+	s.cmd.Stderr = io.MultiWriter(os.Stderr, s.outputTail.Writer())
+	s.cmd.WaitDelay = outputWaitDelay
+}
+
+// PrefixOutput prefixes each line of the child process stdout and stderr,
+// so that the output of multiple child processes can be told apart.
+// Must be called before Start.
+func (s *Supervisor) PrefixOutput(prefix string) {
+	stdout := newPrefixWriter(s.cmd.Stdout, prefix)
+	stderr := newPrefixWriter(s.cmd.Stderr, prefix)
+	s.prefixWriters = append(s.prefixWriters, stdout, stderr)
+	s.cmd.Stdout = stdout
+	s.cmd.Stderr = stderr
+	s.cmd.WaitDelay = outputWaitDelay
+}
+
+// SetRestartPolicy sets the policy for restarting the child process after it
+// exits. Restarts stop once shutdown is requested or a TERM or INT signal is
+// received. Must be called before Start.
+func (s *Supervisor) SetRestartPolicy(policy RestartPolicy) {
+	s.restartPolicy = policy
+}
+
+// OnRestart adds a hook to call before the child process is restarted.
+// Hooks are called in the order added. Must be called before Start.
+func (s *Supervisor) OnRestart(hook RestartHook) {
+	s.restartHooks = append(s.restartHooks, hook)
+}
+
+// OnRestarted adds a hook to call after the child process is restarted.
+// Hooks are called in the order added. Must be called before Start.
+func (s *Supervisor) OnRestarted(hook RestartedHook) {
+	s.restartedHooks = append(s.restartedHooks, hook)
+}
+
+// OutputTail returns the last lines of the child process output, if
+// TailOutput was called.
+func (s *Supervisor) OutputTail() []string {
+	if s.outputTail == nil {
+		return nil
 	}
+	return s.outputTail.Lines()
 }
 
 func (s *Supervisor) Start() error {
@@ -43,6 +128,7 @@ func (s *Supervisor) Start() error {
 	if err := s.cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start child process: %v", err)
 	}
+	s.started = time.Now()
 
 	// Propegate all signals to the child process
 	s.sigCh = make(chan os.Signal, 1)
@@ -62,31 +148,165 @@ func (s *Supervisor) Start() error {
 			if sig == syscall.SIGCHLD {
 				continue
 			}
-			err := s.cmd.Process.Signal(sig)
-			if err != nil {
-				log.Printf("Signal propegation failed: %v\n", err)
+			// don't restart a child process that was told to exit
+			if sig == syscall.SIGTERM || sig == syscall.SIGINT {
+				s.stop()
+				s.forwardShutdown(sig)
+				continue
 			}
+			s.signal(sig)
 		}
 	}()
 
 	return nil
 }
 
+// Wait waits for the child process to exit. With a restart policy, the
+// child process is restarted after it exits, and Wait returns once it exits
+// without being restarted.
 func (s *Supervisor) Wait() error {
 	defer func() {
-		signal.Reset()
 		if s.sigCh != nil {
+			// Stop only this supervisor's notifications, so that signals are
+			// still propagated to other child processes.
+			signal.Stop(s.sigCh)
 			close(s.sigCh)
 		}
 		if s.shutdownTimer != nil {
 			s.shutdownTimer.Stop()
 		}
 	}()
-	log.Println("Waiting for child process to exit...")
-	return s.cmd.Wait()
+	for {
+		log.Println("Waiting for child process to exit...")
+		err := s.cmd.Wait()
+		for _, w := range s.prefixWriters {
+			if err := w.Flush(); err != nil {
+				log.Printf("Failed to flush output: %v\n", err)
+			}
+		}
+
+		restarted, restartErr := s.restart(err)
+		if restartErr != nil {
+			return restartErr
+		}
+		if !restarted {
+			return err
+		}
+		for _, hook := range s.restartedHooks {
+			hook(s.restarts)
+		}
+	}
+}
+
+// restart restarts the child process after the backoff delay, if the
+// restart policy allows it and shutdown was not requested.
+func (s *Supervisor) restart(exitErr error) (bool, error) {
+	if s.stopping() || !s.restartPolicy.shouldRestart(s.restarts, exitErr) {
+		return false, nil
+	}
+	s.restarts++
+	if s.restartPolicy.MaxBackoff > 0 && time.Since(s.started) > s.restartPolicy.MaxBackoff {
+		// the child process ran long enough to be considered recovered
+		s.backoffSteps = 0
+	}
+	code := ExitCode(exitErr)
+	delay := s.restartPolicy.delay(s.backoffSteps)
+	s.backoffSteps++
+	for _, hook := range s.restartHooks {
+		hook(s.restarts, code, delay)
+	}
+
+	log.Printf("Restarting child process in %s (restart %d)...\n", delay, s.restarts)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-s.stopCh:
+		log.Println("Skipping restart: shutdown requested")
+		return false, nil
+	}
+
+	s.startStopLock.Lock()
+	defer s.startStopLock.Unlock()
+
+	if s.stopping() {
+		log.Println("Skipping restart: shutdown requested")
+		return false, nil
+	}
+	// an exec.Cmd can only be started once
+	cmd := &exec.Cmd{
+		Path:      s.cmd.Path,
+		Args:      s.cmd.Args,
+		Env:       s.cmd.Env,
+		Stdin:     s.cmd.Stdin,
+		Stdout:    s.cmd.Stdout,
+		Stderr:    s.cmd.Stderr,
+		WaitDelay: s.cmd.WaitDelay,
+	}
+	log.Printf("Starting: %s\n", s)
+	if err := cmd.Start(); err != nil {
+		return false, fmt.Errorf("failed to restart child process: %v", err)
+	}
+	s.cmd = cmd
+	s.started = time.Now()
+	return true, nil
+}
+
+// Restarts returns the number of times the child process was restarted.
+func (s *Supervisor) Restarts() int {
+	return s.restarts
+}
+
+// stop stops restarts. Safe to call more than once.
+func (s *Supervisor) stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+}
+
+func (s *Supervisor) stopping() bool {
+	select {
+	case <-s.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// signal propagates a signal to the child process, if running.
+func (s *Supervisor) signal(sig os.Signal) {
+	s.startStopLock.Lock()
+	defer s.startStopLock.Unlock()
+
+	if !s.isRunning() {
+		return
+	}
+	err := s.cmd.Process.Signal(sig)
+	if err != nil {
+		log.Printf("Signal propegation failed: %v\n", err)
+	}
+}
+
+// forwardShutdown calls the shutdown hooks and propagates a shutdown signal
+// received by the supervisor to the child process, if running.
+func (s *Supervisor) forwardShutdown(sig os.Signal) {
+	s.startStopLock.Lock()
+	defer s.startStopLock.Unlock()
+
+	if !s.isRunning() {
+		return
+	}
+	for _, hook := range s.shutdownHooks {
+		hook(sig)
+	}
+	err := s.cmd.Process.Signal(sig)
+	if err != nil {
+		log.Printf("Signal propegation failed: %v\n", err)
+	}
 }
 
 func (s *Supervisor) ShutdownNow() error {
+	s.stop()
 	s.startStopLock.Lock()
 	defer s.startStopLock.Unlock()
 
@@ -96,6 +316,9 @@ func (s *Supervisor) ShutdownNow() error {
 	}
 
 	log.Println("Killing child process...")
+	for _, hook := range s.shutdownHooks {
+		hook(syscall.SIGKILL)
+	}
 	// TODO: Use Process.Kill() instead?
 	// Sending Interrupt on Windows is not implemented.
 	err := s.cmd.Process.Signal(syscall.SIGKILL)
@@ -106,6 +329,7 @@ func (s *Supervisor) ShutdownNow() error {
 }
 
 func (s *Supervisor) ShutdownWithTimeout(timeout time.Duration) error {
+	s.stop()
 	s.startStopLock.Lock()
 	defer s.startStopLock.Unlock()
 
@@ -119,6 +343,9 @@ func (s *Supervisor) ShutdownWithTimeout(timeout time.Duration) error {
 	}
 
 	log.Println("Terminating child process...")
+	for _, hook := range s.shutdownHooks {
+		hook(syscall.SIGTERM)
+	}
 	err := s.cmd.Process.Signal(syscall.SIGTERM)
 	if err != nil {
 		return fmt.Errorf("failed to terminate child process: %v", err)
@@ -0,0 +1,71 @@
+package supervisor
+
+import (
+	"io"
+	"sync"
+)
+
+// tail keeps the last N complete lines written by one or more streams.
+type tail struct {
+	lock  sync.Mutex
+	max   int
+	lines []string
+	// incomplete last line, by stream
+	partials []*lineBuffer
+}
+
+func newTail(max int) *tail {
+	return &tail{max: max}
+}
+
+// Writer returns an io.Writer for a stream. Each stream buffers its own
+// incomplete line, so that concurrent streams (ex: stdout and stderr) don't
+// mix partial lines.
+func (t *tail) Writer() io.Writer {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	lines := &lineBuffer{}
+	t.partials = append(t.partials, lines)
+	return &tailWriter{tail: t, lines: lines}
+}
+
+func (t *tail) append(line string) {
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.max {
+		t.lines = t.lines[len(t.lines)-t.max:]
+	}
+}
+
+// Lines returns the last N lines, including any incomplete last lines.
+func (t *tail) Lines() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	lines := append([]string(nil), t.lines...)
+	for _, partial := range t.partials {
+		if len(partial.partial) > 0 {
+			lines = append(lines, string(partial.partial))
+		}
+	}
+	if len(lines) > t.max {
+		lines = lines[len(lines)-t.max:]
+	}
+	return lines
+}
+
+type tailWriter struct {
+	tail  *tail
+	lines *lineBuffer
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.tail.lock.Lock()
+	defer w.tail.lock.Unlock()
+
+	// appending never fails
+	_ = w.lines.write(p, func(line []byte) error {
+		w.tail.append(string(line))
+		return nil
+	})
+	return len(p), nil
+}
@@ -0,0 +1,67 @@
+package supervisor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTailLines(t *testing.T) {
+	tail := newTail(3)
+	stdout := tail.Writer()
+	stderr := tail.Writer()
+
+	stdout.Write([]byte("one\ntw"))
+	stderr.Write([]byte("err"))
+	stdout.Write([]byte("o\nthree\nfour\nfi"))
+
+	expected := []string{"four", "fi", "err"}
+	if lines := tail.Lines(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %q, got %q", expected, lines)
+	}
+}
+
+func TestTailLongLine(t *testing.T) {
+	tail := newTail(10)
+	w := tail.Writer()
+
+	for i := 0; i < 3; i++ {
+		w.Write([]byte(strings.Repeat("x", maxPartialLine)))
+	}
+	w.Write([]byte("y"))
+
+	lines := tail.Lines()
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %d", len(lines))
+	}
+	for _, line := range lines[:3] {
+		if len(line) != maxPartialLine {
+			t.Errorf("expected line length %d, got %d", maxPartialLine, len(line))
+		}
+	}
+	if lines[3] != "y" {
+		t.Errorf("expected partial line %q, got %q", "y", lines[3])
+	}
+}
+
+func TestTailLongLineMultiByte(t *testing.T) {
+	tail := newTail(10)
+	w := tail.Writer()
+
+	// the limit falls in the middle of the last rune
+	w.Write([]byte(strings.Repeat("x", maxPartialLine-1) + "世界"))
+
+	lines := tail.Lines()
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+	if lines[0] != strings.Repeat("x", maxPartialLine-1) || lines[1] != "世界" {
+		t.Errorf("expected the line to be split before the rune, got %d and %q", len(lines[0]), lines[1])
+	}
+	for _, line := range lines {
+		if !utf8.ValidString(line) {
+			t.Errorf("expected valid UTF-8, got %q", line)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package termination
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultPath is the default Kubernetes container terminationMessagePath.
+const DefaultPath = "/dev/termination-log"
+
+// MaxBytes is the maximum size of a Kubernetes termination message.
+// Longer messages are truncated by the kubelet.
+const MaxBytes = 4096
+
+// Message is a termination message summarizing why the supervised process
+// exited. A nil *Message is valid and writes nothing.
+type Message struct {
+	Path string
+
+	lock   sync.Mutex
+	reason string
+}
+
+// New returns a Message to be written to the path.
+func New(path string) *Message {
+	return &Message{Path: path}
+}
+
+// SetReason sets the reason for termination, unless already set.
+// The first reason wins, because later failures are usually consequences.
+// Safe to call from multiple goroutines.
+func (m *Message) SetReason(format string, args ...interface{}) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.reason == "" {
+		m.reason = fmt.Sprintf(format, args...)
+	}
+}
+
+// Reason returns the reason for termination, or "exited" if not set.
+func (m *Message) Reason() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.reason == "" {
+		return "exited"
+	}
+	return m.reason
+}
+
+// Write writes the termination message with the exit code, reason, and the
+// last lines of output, if any.
+// The file must already exist (Kubernetes creates it), so that running
+// outside of Kubernetes does not create stray files.
+func (m *Message) Write(code int, output []string) error {
+	if m == nil {
+		return nil
+	}
+
+	file, err := os.OpenFile(m.Path, os.O_WRONLY|os.O_TRUNC, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("Skipping termination message: file not found: %s\n", m.Path)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open termination message file: %v", err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(Format(code, m.Reason(), output))
+	if err != nil {
+		return fmt.Errorf("failed to write termination message: %v", err)
+	}
+	return nil
+}
+
+// Format returns a termination message no longer than MaxBytes.
+// The oldest output lines are dropped to fit.
+func Format(code int, reason string, output []string) string {
+	header := fmt.Sprintf("Exited(%d): %s\n", code, reason)
+	if len(header) > MaxBytes {
+		return truncate(header, MaxBytes)
+	}
+
+	for len(output) > 0 {
+		msg := fmt.Sprintf("%sLast %d line(s) of output:\n%s\n", header, len(output), strings.Join(output, "\n"))
+		if len(msg) <= MaxBytes {
+			return msg
+		}
+		output = output[1:]
+	}
+	return header
+}
+
+// truncate returns s cut to at most n bytes, without splitting a UTF-8 rune,
+// so that the message stays valid UTF-8.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
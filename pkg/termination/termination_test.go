@@ -0,0 +1,88 @@
+package termination
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFormat(t *testing.T) {
+	msg := Format(1, "exited", []string{"one", "two"})
+	expected := "Exited(1): exited\nLast 2 line(s) of output:\none\ntwo\n"
+	if msg != expected {
+		t.Errorf("expected %q, got %q", expected, msg)
+	}
+
+	msg = Format(0, "exited", nil)
+	if msg != "Exited(0): exited\n" {
+		t.Errorf("expected header only, got %q", msg)
+	}
+}
+
+func TestFormatDropsOldestLines(t *testing.T) {
+	long := strings.Repeat("x", MaxBytes/2)
+	msg := Format(1, "exited", []string{"old " + long, "new " + long, "last"})
+	if len(msg) > MaxBytes {
+		t.Fatalf("expected at most %d bytes, got %d", MaxBytes, len(msg))
+	}
+	if strings.Contains(msg, "old") || !strings.Contains(msg, "new") || !strings.Contains(msg, "Last 2 line(s)") {
+		t.Errorf("expected the oldest line to be dropped, got %q", msg[:64])
+	}
+}
+
+func TestFormatTruncatesMultiByteReason(t *testing.T) {
+	prefix := "Exited(1): "
+	// offset the runes so that the limit falls in the middle of one
+	for offset := 0; offset < utf8.UTFMax; offset++ {
+		reason := strings.Repeat("x", offset) + strings.Repeat("世", MaxBytes)
+		msg := Format(1, reason, []string{"output"})
+		if len(msg) > MaxBytes || len(msg) < MaxBytes-utf8.UTFMax {
+			t.Errorf("offset %d: expected about %d bytes, got %d", offset, MaxBytes, len(msg))
+		}
+		if !utf8.ValidString(msg) {
+			t.Errorf("offset %d: expected valid UTF-8, got %q", offset, msg[len(msg)-8:])
+		}
+		if !strings.HasPrefix(msg, prefix) {
+			t.Errorf("offset %d: expected prefix %q", offset, prefix)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "termination-log")
+
+	// skipped if the file doesn't exist
+	m := New(path)
+	if err := m.Write(0, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no file, got: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("stale message that is longer"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	m.SetReason("terminated: %s", "first")
+	m.SetReason("terminated: %s", "second")
+	if err := m.Write(143, []string{"bye"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	expected := "Exited(143): terminated: first\nLast 1 line(s) of output:\nbye\n"
+	if string(data) != expected {
+		t.Errorf("expected %q, got %q", expected, data)
+	}
+
+	// nil messages write nothing
+	var nilMessage *Message
+	nilMessage.SetReason("ignored")
+	if err := nilMessage.Write(1, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,51 +16,212 @@ import (
 	"sigs.k8s.io/yaml"
 )
 
+// WriteHook is called after a tombstone is written to the graveyard, with a
+// copy of the tombstone as written.
+type WriteHook func(*Tombstone)
+
+// Role is the role of a process in the pod.
+type Role string
+
+const (
+	// RolePrimary processes do the work of the pod.
+	RolePrimary Role = "primary"
+	// RoleSidecar processes support the primary processes, and are shut down
+	// once every primary process has died.
+	RoleSidecar Role = "sidecar"
+)
+
+// ParseRole parses a role. Empty is no role.
+func ParseRole(s string) (Role, error) {
+	switch r := Role(strings.ToLower(s)); r {
+	case "", RolePrimary, RoleSidecar:
+		return r, nil
+	default:
+		return "", fmt.Errorf("invalid role: %q: expected %s or %s", s, RolePrimary, RoleSidecar)
+	}
+}
+
 type Tombstone struct {
 	Born     *time.Time `json:",omitempty"`
 	Died     *time.Time `json:",omitempty"`
 	ExitCode *int       `json:",omitempty"`
 
+	// Restarts is the number of in-process restarts of the child process,
+	// with the time and exit code of the last exit before a restart.
+	Restarts     int        `json:",omitempty"`
+	LastExited   *time.Time `json:",omitempty"`
+	LastExitCode *int       `json:",omitempty"`
+
+	// Role of the process, if any. Sidecars watch the graveyard for the
+	// death of every primary.
+	Role Role `json:",omitempty"`
+
+	// FateGroup of the process, if any. A non-zero death of any member
+	// terminates every other member.
+	FateGroup string `json:",omitempty"`
+	// FailedBy is the name of the fate group member whose non-zero death
+	// terminated this process. The ExitCode is propagated from it.
+	FailedBy string `json:",omitempty"`
+
+	// The dependencies and timeouts of the process, so that the graveyard
+	// describes the dependency graph of the pod.
+	BirthDeps      []string `json:",omitempty"`
+	BirthTimeout   string   `json:",omitempty"`
+	BirthStability string   `json:",omitempty"`
+	DeathDeps      []string `json:",omitempty"`
+	GracePeriod    string   `json:",omitempty"`
+
+	// WaitingFor are the names of the birth deps in the same pod that the
+	// process is waiting for, before it is born. Used to detect deadlocks
+	// caused by birth dep cycles.
+	WaitingFor []string `json:",omitempty"`
+
 	Graveyard string `json:"-"`
 	Name      string `json:"-"`
 
+	// OnWrite is called asyncronously after a successful Write, if not nil.
+	// Hooks are called one at a time, in order, but writes that happen while
+	// a hook is running are coalesced, so that only the latest is passed to
+	// the next hook.
+	OnWrite WriteHook `json:"-"`
+
 	fileLock sync.Mutex
+
+	hookLock    sync.Mutex
+	hookIdle    *sync.Cond
+	hookPending *Tombstone
+	hookRunning bool
 }
 
 func (t *Tombstone) Path() string {
 	return filepath.Join(t.Graveyard, t.Name)
 }
 
-// Write a tombstone file, truncating before writing.
+// Write a tombstone file, replacing it atomically, so that readers never see
+// a partially written tombstone. The temporary file is hidden, so that it
+// is ignored by ReadAll.
 // If the FilePath directories do not exist, they will be created.
 func (t *Tombstone) Write() error {
+	written, err := t.write()
+	if err != nil {
+		return err
+	}
+	if t.OnWrite != nil {
+		t.queueHook(written)
+	}
+	return nil
+}
+
+// write writes the tombstone file, and returns a copy of the tombstone as
+// written.
+func (t *Tombstone) write() (*Tombstone, error) {
 	// one write at a time
 	t.fileLock.Lock()
 	defer t.fileLock.Unlock()
 
 	err := os.MkdirAll(t.Graveyard, os.ModePerm)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// does not exit
-	file, err := os.Create(t.Path())
+	pretty, err := yaml.Marshal(t)
 	if err != nil {
-		return fmt.Errorf("failed to create tombstone file: %v", err)
+		return nil, fmt.Errorf("failed to marshal tombstone yaml: %v", err)
 	}
-	defer file.Close()
 
-	pretty, err := yaml.Marshal(t)
+	file, err := os.CreateTemp(t.Graveyard, "."+t.Name+".*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tombstone file: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	// readable by processes in other containers, which may use other users
+	err = file.Chmod(0644)
+	if err == nil {
+		_, err = file.Write(pretty)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write tombstone file: %v", err)
+	}
+
+	err = os.Rename(file.Name(), t.Path())
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace tombstone file: %v", err)
+	}
+
+	written := &Tombstone{Graveyard: t.Graveyard, Name: t.Name}
+	err = yaml.Unmarshal(pretty, written)
 	if err != nil {
-		return fmt.Errorf("failed to marshal tombstone yaml: %v", err)
+		return nil, fmt.Errorf("failed to copy tombstone: %v", err)
+	}
+	return written, nil
+}
+
+// queueHook calls the OnWrite hook with the written tombstone in the
+// background, replacing any tombstone still waiting for the hook.
+func (t *Tombstone) queueHook(written *Tombstone) {
+	t.hookLock.Lock()
+	defer t.hookLock.Unlock()
+
+	t.hookPending = written
+	if !t.hookRunning {
+		t.hookRunning = true
+		go t.runHooks()
+	}
+}
+
+func (t *Tombstone) runHooks() {
+	for {
+		t.hookLock.Lock()
+		written := t.hookPending
+		t.hookPending = nil
+		if written == nil {
+			t.hookRunning = false
+			if t.hookIdle != nil {
+				t.hookIdle.Broadcast()
+			}
+			t.hookLock.Unlock()
+			return
+		}
+		t.hookLock.Unlock()
+
+		t.OnWrite(written)
+	}
+}
+
+// WaitForHooks blocks until the OnWrite hook has been called with the latest
+// written tombstone.
+func (t *Tombstone) WaitForHooks() {
+	t.hookLock.Lock()
+	defer t.hookLock.Unlock()
+
+	if t.hookIdle == nil {
+		t.hookIdle = sync.NewCond(&t.hookLock)
+	}
+	for t.hookRunning {
+		t.hookIdle.Wait()
+	}
+}
+
+// RecordWaiting writes a tombstone with the names of the birth deps that the
+// process is waiting for, before it is born.
+func (t *Tombstone) RecordWaiting(names []string) error {
+	t.WaitingFor = names
+
+	err := t.Write()
+	if err != nil {
+		return fmt.Errorf("failed to update tombstone: %v", err)
 	}
-	file.Write(pretty)
 	return nil
 }
 
 func (t *Tombstone) RecordBirth() error {
 	born := time.Now()
 	t.Born = &born
+	t.WaitingFor = nil
 
 	log.Printf("Creating tombstone: %s\n", t.Path())
 	err := t.Write()
@@ -69,11 +231,31 @@ func (t *Tombstone) RecordBirth() error {
 	return nil
 }
 
+// RecordRestart writes a tombstone with the restart count and the exit code
+// of the child process before the restart. The process is not dead, so Died
+// is not set.
+func (t *Tombstone) RecordRestart(restarts, exitCode int) error {
+	code := exitCode
+	exited := time.Now()
+	t.Restarts = restarts
+	t.LastExited = &exited
+	t.LastExitCode = &code
+
+	log.Printf("Updating tombstone: %s\n", t.Path())
+	err := t.Write()
+	if err != nil {
+		return fmt.Errorf("failed to update tombstone: %v", err)
+	}
+	return nil
+}
+
 func (t *Tombstone) RecordDeath(exitCode int) error {
 	code := exitCode
 	died := time.Now()
 	t.Died = &died
 	t.ExitCode = &code
+	// a dead process is no longer waiting for its birth deps
+	t.WaitingFor = nil
 
 	log.Printf("Updating tombstone: %s\n", t.Path())
 	err := t.Write()
@@ -112,6 +294,45 @@ func Read(graveyard, name string) (*Tombstone, error) {
 	return &t, nil
 }
 
+// ReadAll reads all the tombstones in a graveyard, sorted by name.
+// Hidden files are ignored.
+func ReadAll(graveyard string) ([]*Tombstone, error) {
+	entries, err := os.ReadDir(graveyard)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read graveyard: %v", err)
+	}
+	var tombstones []*Tombstone
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		t, err := Read(graveyard, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		tombstones = append(tombstones, t)
+	}
+	return tombstones, nil
+}
+
+// PrimariesDied returns the tombstones with the primary role, and whether
+// all of them have died. False if there are fewer than minPrimaries (at
+// least one), so that primaries that have not written their tombstones yet
+// can be waited for.
+func PrimariesDied(tombstones []*Tombstone, minPrimaries int) ([]*Tombstone, bool) {
+	var primaries []*Tombstone
+	for _, t := range tombstones {
+		if t.Role != RolePrimary {
+			continue
+		}
+		if t.Died == nil {
+			return nil, false
+		}
+		primaries = append(primaries, t)
+	}
+	return primaries, len(primaries) > 0 && len(primaries) >= minPrimaries
+}
+
 type EventHandler func(fsnotify.Event)
 
 // LoggingEventHandler is an example EventHandler that logs fsnotify events
@@ -0,0 +1,122 @@
+package tombstone
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteRead(t *testing.T) {
+	ts := &Tombstone{Graveyard: t.TempDir(), Name: "app", Role: RolePrimary}
+	if err := ts.RecordBirth(); err != nil {
+		t.Fatalf("failed to record birth: %v", err)
+	}
+	if err := ts.RecordDeath(3); err != nil {
+		t.Fatalf("failed to record death: %v", err)
+	}
+
+	read, err := Read(ts.Graveyard, "app")
+	if err != nil {
+		t.Fatalf("failed to read tombstone: %v", err)
+	}
+	if read.Born == nil || read.Died == nil || read.ExitCode == nil || *read.ExitCode != 3 || read.Role != RolePrimary {
+		t.Errorf("unexpected tombstone: %s", read)
+	}
+}
+
+func TestOnWriteLatest(t *testing.T) {
+	release := make(chan struct{})
+	var lock sync.Mutex
+	var calls []int
+
+	ts := &Tombstone{Graveyard: t.TempDir(), Name: "app"}
+	ts.OnWrite = func(written *Tombstone) {
+		if written == ts {
+			t.Error("expected a copy of the tombstone")
+		}
+		lock.Lock()
+		calls = append(calls, written.Restarts)
+		first := len(calls) == 1
+		lock.Unlock()
+		if first {
+			// block until every write has been queued
+			<-release
+		}
+	}
+
+	start := time.Now()
+	for i := 1; i <= 5; i++ {
+		ts.Restarts = i
+		if err := ts.Write(); err != nil {
+			t.Fatalf("failed to write tombstone: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected writes not to wait for the hook, took %s", elapsed)
+	}
+	close(release)
+	ts.WaitForHooks()
+
+	lock.Lock()
+	defer lock.Unlock()
+	// the hook may start before or after the first write is replaced
+	if len(calls) == 0 || calls[len(calls)-1] != 5 {
+		t.Errorf("expected the latest write to be hooked, got %v", calls)
+	}
+	if len(calls) > 2 {
+		t.Errorf("expected writes during the hook to be coalesced, got %v", calls)
+	}
+}
+
+func TestWaitForHooksWithoutWrites(t *testing.T) {
+	ts := &Tombstone{Graveyard: t.TempDir(), Name: "app"}
+	ts.WaitForHooks()
+}
+
+func TestPrimariesDied(t *testing.T) {
+	now := time.Now()
+	dead := func(name string, role Role) *Tombstone {
+		return &Tombstone{Name: name, Role: role, Died: &now}
+	}
+	alive := &Tombstone{Name: "b", Role: RolePrimary}
+
+	tests := []struct {
+		name         string
+		tombstones   []*Tombstone
+		minPrimaries int
+		expected     bool
+	}{
+		{"none", nil, 1, false},
+		{"only sidecars", []*Tombstone{dead("s", RoleSidecar)}, 1, false},
+		{"one dead", []*Tombstone{dead("a", RolePrimary)}, 1, true},
+		{"one alive", []*Tombstone{dead("a", RolePrimary), alive}, 1, false},
+		{"fewer than min", []*Tombstone{dead("a", RolePrimary)}, 2, false},
+		{"min dead", []*Tombstone{dead("a", RolePrimary), dead("b", RolePrimary)}, 2, true},
+		{"zero min", []*Tombstone{dead("a", RolePrimary)}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, died := PrimariesDied(tt.tombstones, tt.minPrimaries); died != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, died)
+			}
+		})
+	}
+}
+
+func TestRecordDeathClearsWaiting(t *testing.T) {
+	ts := &Tombstone{Graveyard: t.TempDir(), Name: "app"}
+	if err := ts.RecordWaiting([]string{"db"}); err != nil {
+		t.Fatalf("failed to record waiting: %v", err)
+	}
+	if err := ts.RecordDeath(1); err != nil {
+		t.Fatalf("failed to record death: %v", err)
+	}
+
+	read, err := Read(ts.Graveyard, "app")
+	if err != nil {
+		t.Fatalf("failed to read tombstone: %v", err)
+	}
+	if len(read.WaitingFor) != 0 {
+		t.Errorf("expected dead process not to be waiting, got: %q", read.WaitingFor)
+	}
+}
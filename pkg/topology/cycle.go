@@ -0,0 +1,86 @@
+package topology
+
+import "sort"
+
+// FindCycle returns the first cycle found in a directed graph, as a path of
+// node names that starts and ends with the same node, or nil if there are no
+// cycles. Nodes are visited in sorted order, so the result is deterministic.
+func FindCycle(graph map[string][]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var stack []string
+
+	var visit func(node string) []string
+	visit = func(node string) []string {
+		state[node] = visiting
+		stack = append(stack, node)
+		for _, next := range graph[node] {
+			switch state[next] {
+			case visiting:
+				// found a cycle: slice the stack from the first occurrence
+				for i, n := range stack {
+					if n == next {
+						cycle := append([]string(nil), stack[i:]...)
+						return append(cycle, next)
+					}
+				}
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[node] = visited
+		return nil
+	}
+
+	nodes := make([]string, 0, len(graph))
+	for node := range graph {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		if state[node] == unvisited {
+			if cycle := visit(node); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// FindCycleThrough returns a cycle in a directed graph that passes through
+// the start node, as a path that starts and ends with the start node, or nil
+// if there is no such cycle. Edges are followed in sorted order, so the
+// result is deterministic.
+func FindCycleThrough(graph map[string][]string, start string) []string {
+	visited := map[string]bool{}
+	var stack []string
+
+	var visit func(node string) []string
+	visit = func(node string) []string {
+		visited[node] = true
+		stack = append(stack, node)
+		next := append([]string{}, graph[node]...)
+		sort.Strings(next)
+		for _, dep := range next {
+			if dep == start {
+				return append(append([]string{}, stack...), start)
+			}
+			if visited[dep] {
+				continue
+			}
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		return nil
+	}
+	return visit(start)
+}
@@ -0,0 +1,88 @@
+package topology
+
+import (
+	"path"
+	"strings"
+
+	"github.com/karlkfi/kubexit/pkg/podinfo"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// FromPodSpec returns the topology of the kubexit processes in a pod spec,
+// from the KUBEXIT_* env vars of the containers and the deps annotations of
+// the pod. Env vars take precedence over annotations.
+// Containers are kubexit processes if they have KUBEXIT_* env vars, a
+// kubexit command, or a deps annotation. Processes are named by
+// KUBEXIT_NAME, if set, otherwise by container name.
+func FromPodSpec(spec corev1.PodSpec, annotations map[string]string) (*Topology, error) {
+	t := &Topology{Processes: map[string]Process{}}
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, container := range containers {
+		env := map[string]string{}
+		for _, envVar := range container.Env {
+			if strings.HasPrefix(envVar.Name, "KUBEXIT_") {
+				env[envVar.Name] = envVar.Value
+			}
+		}
+
+		var deps podinfo.Deps
+		value, annotated := annotations[podinfo.DepsAnnotationPrefix+container.Name]
+		if annotated {
+			var err error
+			deps, err = podinfo.ParseDeps(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		wrapped := len(container.Command) > 0 && path.Base(container.Command[0]) == "kubexit"
+		if len(env) == 0 && !wrapped && !annotated {
+			continue
+		}
+
+		name := container.Name
+		if env["KUBEXIT_NAME"] != "" {
+			name = env["KUBEXIT_NAME"]
+		}
+		t.Processes[name] = Process{
+			BirthDeps:      splitDeps(firstNonEmpty(env["KUBEXIT_BIRTH_DEPS"], deps.Birth)),
+			BirthTimeout:   env["KUBEXIT_BIRTH_TIMEOUT"],
+			BirthStability: env["KUBEXIT_BIRTH_STABILITY"],
+			DeathDeps:      splitDeps(firstNonEmpty(env["KUBEXIT_DEATH_DEPS"], deps.Death)),
+			GracePeriod:    env["KUBEXIT_GRACE_PERIOD"],
+			Role:           env["KUBEXIT_ROLE"],
+			FateGroup:      env["KUBEXIT_FATE_GROUP"],
+			Probes:         probesOf(container),
+		}
+	}
+	return t, nil
+}
+
+// probesOf returns the startup and readiness probes of the container, or nil
+// if it has neither.
+func probesOf(container corev1.Container) *Probes {
+	if container.StartupProbe == nil && container.ReadinessProbe == nil {
+		return nil
+	}
+	return &Probes{
+		Startup:   container.StartupProbe,
+		Readiness: container.ReadinessProbe,
+	}
+}
+
+func splitDeps(deps string) []string {
+	if deps == "" {
+		return nil
+	}
+	return strings.Split(deps, ",")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,207 @@
+package topology
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/karlkfi/kubexit/pkg/birth"
+	"github.com/karlkfi/kubexit/pkg/tombstone"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Topology describes every kubexit process in a pod and its dependencies.
+// It is usually mounted into all containers from the same ConfigMap, so
+// that the whole graph can be validated by every process.
+type Topology struct {
+	Processes map[string]Process `json:"processes"`
+}
+
+// Process describes the dependencies and shutdown policy of one process.
+// Durations use Go duration syntax (ex: `30s`). Empty values use defaults.
+type Process struct {
+	// BirthDeps use the same syntax as KUBEXIT_BIRTH_DEPS, including
+	// conditions (ex: `proxy:started`), which select the probe or state
+	// that must be reached.
+	BirthDeps      []string `json:"birthDeps,omitempty"`
+	BirthTimeout   string   `json:"birthTimeout,omitempty"`
+	BirthStability string   `json:"birthStability,omitempty"`
+	DeathDeps      []string `json:"deathDeps,omitempty"`
+	GracePeriod    string   `json:"gracePeriod,omitempty"`
+	// Role is `primary`, `sidecar`, or empty. Sidecars are shut down once
+	// every primary has died.
+	Role string `json:"role,omitempty"`
+	// FateGroup is the name of a group of processes that fail together:
+	// a non-zero death of any member terminates every other member.
+	FateGroup string `json:"fateGroup,omitempty"`
+	// Probes of the process container, which determine when it is started
+	// and ready, for the birth deps of other processes on it.
+	Probes *Probes `json:"probes,omitempty"`
+}
+
+// Probes are the Kubernetes container probes of a process. Without a
+// startup probe, a process is started when it is running. Without a
+// readiness probe, a process is ready when it is started.
+type Probes struct {
+	Startup   *corev1.Probe `json:"startup,omitempty"`
+	Readiness *corev1.Probe `json:"readiness,omitempty"`
+}
+
+// Read reads a topology YAML file.
+func Read(path string) (*Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read topology file: %v", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses topology YAML.
+func Parse(data []byte) (*Topology, error) {
+	t := &Topology{}
+	err := yaml.UnmarshalStrict(data, t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal topology yaml: %v", err)
+	}
+	return t, nil
+}
+
+// Validate checks the whole graph: dependency syntax, durations, names of
+// unknown processes, and birth dependency cycles.
+// Birth dependencies on other workloads (services, pods, objects) are not
+// processes and are not checked against the process names.
+func (t *Topology) Validate() error {
+	var errs []string
+	for _, name := range t.Names() {
+		proc := t.Processes[name]
+		for _, depStr := range proc.BirthDeps {
+			dep, err := birth.ParseDependency(depStr)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("process %s: %v", name, err))
+				continue
+			}
+			if dep.Kind == birth.KindContainer {
+				if _, ok := t.Processes[dep.Name]; !ok {
+					errs = append(errs, fmt.Sprintf("process %s: unknown birth dep: %s", name, dep.Name))
+				}
+			}
+		}
+		for _, dep := range proc.DeathDeps {
+			if _, ok := t.Processes[dep]; !ok {
+				errs = append(errs, fmt.Sprintf("process %s: unknown death dep: %s", name, dep))
+			}
+		}
+		if _, err := tombstone.ParseRole(proc.Role); err != nil {
+			errs = append(errs, fmt.Sprintf("process %s: %v", name, err))
+		}
+		if proc.Probes != nil {
+			for probeName, probe := range map[string]*corev1.Probe{
+				"startup":   proc.Probes.Startup,
+				"readiness": proc.Probes.Readiness,
+			} {
+				if err := validateProbe(probe); err != nil {
+					errs = append(errs, fmt.Sprintf("process %s: invalid %s probe: %v", name, probeName, err))
+				}
+			}
+		}
+		for field, value := range map[string]string{
+			"birthTimeout":   proc.BirthTimeout,
+			"birthStability": proc.BirthStability,
+			"gracePeriod":    proc.GracePeriod,
+		} {
+			if value == "" {
+				continue
+			}
+			if d, err := time.ParseDuration(value); err != nil {
+				errs = append(errs, fmt.Sprintf("process %s: invalid %s: %v", name, field, err))
+			} else if d < 0 {
+				errs = append(errs, fmt.Sprintf("process %s: invalid %s: %s: must not be negative", name, field, value))
+			}
+		}
+	}
+
+	if cycle := FindCycle(t.BirthGraph()); cycle != nil {
+		errs = append(errs, fmt.Sprintf("birth dep cycle: %s", strings.Join(cycle, " -> ")))
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("invalid topology:\n- %s", strings.Join(errs, "\n- "))
+	}
+	return nil
+}
+
+// validateProbe checks that a probe, if any, has exactly one handler.
+func validateProbe(probe *corev1.Probe) error {
+	if probe == nil {
+		return nil
+	}
+	var handlers int
+	if probe.Exec != nil {
+		handlers++
+	}
+	if probe.HTTPGet != nil {
+		handlers++
+	}
+	if probe.TCPSocket != nil {
+		handlers++
+	}
+	if probe.GRPC != nil {
+		handlers++
+	}
+	if handlers != 1 {
+		return fmt.Errorf("must have exactly one of exec, httpGet, tcpSocket, or grpc")
+	}
+	return nil
+}
+
+// Names returns the process names, sorted.
+func (t *Topology) Names() []string {
+	names := make([]string, 0, len(t.Processes))
+	for name := range t.Processes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BirthGraph returns the birth dependency graph between processes, by name.
+// Invalid and non-process birth deps are omitted.
+func (t *Topology) BirthGraph() map[string][]string {
+	graph := map[string][]string{}
+	for name, proc := range t.Processes {
+		graph[name] = nil
+		for _, depStr := range proc.BirthDeps {
+			dep, err := birth.ParseDependency(depStr)
+			if err != nil || dep.Kind != birth.KindContainer {
+				continue
+			}
+			graph[name] = append(graph[name], dep.Name)
+		}
+	}
+	return graph
+}
+
+// Primaries returns the number of processes with the primary role.
+func (t *Topology) Primaries() int {
+	var count int
+	for _, proc := range t.Processes {
+		// roles are case-insensitive
+		if role, _ := tombstone.ParseRole(proc.Role); role == tombstone.RolePrimary {
+			count++
+		}
+	}
+	return count
+}
+
+// Process returns the named process.
+func (t *Topology) Process(name string) (Process, error) {
+	proc, ok := t.Processes[name]
+	if !ok {
+		return Process{}, fmt.Errorf("process not found in topology: %s", name)
+	}
+	return proc, nil
+}
@@ -0,0 +1,275 @@
+package topology_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/karlkfi/kubexit/pkg/topology"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		topology string
+		errs     []string
+	}{
+		{
+			name: "valid",
+			topology: `
+processes:
+  client:
+    birthDeps: [server:started, service/db]
+    birthTimeout: 60s
+  server:
+    deathDeps: [client]
+    gracePeriod: 10s
+    role: primary
+    probes:
+      readiness:
+        httpGet:
+          path: /healthz
+          port: 8080
+`,
+		},
+		{
+			name: "unknown deps",
+			topology: `
+processes:
+  client:
+    birthDeps: [server]
+    deathDeps: [proxy]
+`,
+			errs: []string{
+				"process client: unknown birth dep: server",
+				"process client: unknown death dep: proxy",
+			},
+		},
+		{
+			name: "self dep",
+			topology: `
+processes:
+  client:
+    birthDeps: [client]
+`,
+			errs: []string{"birth dep cycle: client -> client"},
+		},
+		{
+			name: "cycle",
+			topology: `
+processes:
+  a:
+    birthDeps: [b]
+  b:
+    birthDeps: [c:started]
+  c:
+    birthDeps: [a]
+`,
+			errs: []string{"birth dep cycle: a -> b -> c -> a"},
+		},
+		{
+			name: "invalid values",
+			topology: `
+processes:
+  client:
+    birthDeps: ["server:healthy"]
+    gracePeriod: -1s
+    role: leader
+  server:
+    probes:
+      startup: {}
+`,
+			errs: []string{
+				`process client: invalid birth dependency "server:healthy": unknown condition: "healthy"`,
+				`process client: invalid role: "leader": expected primary or sidecar`,
+				"process client: invalid gracePeriod: -1s: must not be negative",
+				"process server: invalid startup probe: must have exactly one of exec, httpGet, tcpSocket, or grpc",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topo, err := topology.Parse([]byte(tt.topology))
+			if err != nil {
+				t.Fatalf("failed to parse topology: %v", err)
+			}
+			err = topo.Validate()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			for _, expected := range tt.errs {
+				if !strings.Contains(err.Error(), "\n- "+expected) {
+					t.Errorf("expected error %q, got:\n%v", expected, err)
+				}
+			}
+			if count := strings.Count(err.Error(), "\n- "); count != len(tt.errs) {
+				t.Errorf("expected %d errors, got %d:\n%v", len(tt.errs), count, err)
+			}
+		})
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	tests := []struct {
+		name     string
+		graph    map[string][]string
+		expected []string
+	}{
+		{"empty", nil, nil},
+		{"acyclic", map[string][]string{"a": {"b", "c"}, "b": {"c"}, "c": nil}, nil},
+		{"self", map[string][]string{"a": {"a"}}, []string{"a", "a"}},
+		{"cycle", map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"b"}}, []string{"b", "c", "b"}},
+	}
+	for _, tt := range tests {
+		if cycle := topology.FindCycle(tt.graph); !reflect.DeepEqual(cycle, tt.expected) {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, cycle)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "topology.yaml")
+	err := os.WriteFile(path, []byte("processes:\n  app:\n    gracePeriod: 5s\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write topology: %v", err)
+	}
+	topo, err := topology.Read(path)
+	if err != nil {
+		t.Fatalf("failed to read topology: %v", err)
+	}
+	proc, err := topo.Process("app")
+	if err != nil || proc.GracePeriod != "5s" {
+		t.Errorf("expected app with grace period 5s, got %+v (%v)", proc, err)
+	}
+	if _, err := topo.Process("other"); err == nil {
+		t.Error("expected error for unknown process")
+	}
+
+	err = os.WriteFile(path, []byte("processes:\n  app:\n    unknown: true\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write topology: %v", err)
+	}
+	if _, err := topology.Read(path); err == nil {
+		t.Error("expected error for unknown field")
+	}
+	if _, err := topology.Read(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestPrimaries(t *testing.T) {
+	topo := &topology.Topology{Processes: map[string]topology.Process{
+		"app":    {Role: "primary"},
+		"worker": {Role: "Primary"},
+		"proxy":  {Role: "SIDECAR"},
+		"other":  {},
+	}}
+	if err := topo.Validate(); err != nil {
+		t.Fatalf("expected valid topology: %v", err)
+	}
+	if n := topo.Primaries(); n != 2 {
+		t.Errorf("expected 2 primaries, got %d", n)
+	}
+}
+
+func TestFromPodSpec(t *testing.T) {
+	readiness := &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{},
+		},
+	}
+	spec := corev1.PodSpec{
+		InitContainers: []corev1.Container{{
+			Name: "migrate",
+			Env: []corev1.EnvVar{
+				{Name: "KUBEXIT_NAME", Value: "migrate"},
+			},
+		}},
+		Containers: []corev1.Container{
+			{
+				Name: "app",
+				Env: []corev1.EnvVar{
+					{Name: "KUBEXIT_BIRTH_DEPS", Value: "db"},
+					{Name: "KUBEXIT_GRACE_PERIOD", Value: "5s"},
+				},
+				ReadinessProbe: readiness,
+			},
+			{
+				Name: "db",
+			},
+			{
+				Name:    "proxy",
+				Command: []string{"/kubexit/kubexit", "envoy"},
+				Env: []corev1.EnvVar{
+					{Name: "KUBEXIT_NAME", Value: "envoy"},
+				},
+			},
+			{
+				Name: "unwrapped",
+			},
+		},
+	}
+	annotations := map[string]string{
+		"kubexit.io/deps.app": "birth=migrate:succeeded;death=envoy",
+		"kubexit.io/deps.db":  "death=app",
+	}
+
+	topo, err := topology.FromPodSpec(spec, annotations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]topology.Process{
+		"migrate": {},
+		"app": {
+			// env vars take precedence over annotations
+			BirthDeps:   []string{"db"},
+			DeathDeps:   []string{"envoy"},
+			GracePeriod: "5s",
+			Probes:      &topology.Probes{Readiness: readiness},
+		},
+		"db": {
+			DeathDeps: []string{"app"},
+		},
+		"envoy": {},
+	}
+	if !reflect.DeepEqual(topo.Processes, expected) {
+		t.Errorf("expected:\n%+v\ngot:\n%+v", expected, topo.Processes)
+	}
+
+	_, err = topology.FromPodSpec(spec, map[string]string{"kubexit.io/deps.app": "unknown=x"})
+	if err == nil {
+		t.Error("expected error for invalid annotation")
+	}
+}
+
+func TestFindCycleThrough(t *testing.T) {
+	graph := map[string][]string{
+		"a": {"b"},
+		"b": {"c", "d"},
+		"c": {"a"},
+		"d": {"d"},
+	}
+	tests := []struct {
+		start    string
+		expected []string
+	}{
+		{"a", []string{"a", "b", "c", "a"}},
+		{"b", []string{"b", "c", "a", "b"}},
+		{"d", []string{"d", "d"}},
+		{"e", nil},
+	}
+	for _, tt := range tests {
+		if cycle := topology.FindCycleThrough(graph, tt.start); !reflect.DeepEqual(cycle, tt.expected) {
+			t.Errorf("FindCycleThrough(%s): expected %q, got %q", tt.start, tt.expected, cycle)
+		}
+	}
+}
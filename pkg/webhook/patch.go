@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"fmt"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// patchOperation is a JSON Patch (RFC 6902) operation.
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// specPatch returns the operations that turn the original pod spec into the
+// injected pod spec.
+// Only the fields that injection changes are patched, so that fields the
+// typed PodSpec doesn't know about, like those added by a newer API server,
+// are preserved. Injection only prepends init containers, appends volumes,
+// and replaces or appends container commands, env vars, and volume mounts.
+func specPatch(original, injected *corev1.PodSpec) []patchOperation {
+	var ops []patchOperation
+
+	added := injected.InitContainers[:len(injected.InitContainers)-len(original.InitContainers)]
+	if len(original.InitContainers) == 0 {
+		ops = append(ops, listPatch("/spec/initContainers", nil, added)...)
+	} else {
+		for i := range added {
+			ops = append(ops, patchOperation{Op: "add", Path: fmt.Sprintf("/spec/initContainers/%d", i), Value: added[i]})
+		}
+	}
+
+	for i := range injected.Containers {
+		path := fmt.Sprintf("/spec/containers/%d", i)
+		before, after := &original.Containers[i], &injected.Containers[i]
+		if !reflect.DeepEqual(before.Command, after.Command) {
+			ops = append(ops, patchOperation{Op: "replace", Path: path + "/command", Value: after.Command})
+		}
+		ops = append(ops, listPatch(path+"/env", before.Env, after.Env)...)
+		ops = append(ops, listPatch(path+"/volumeMounts", before.VolumeMounts, after.VolumeMounts)...)
+	}
+
+	ops = append(ops, listPatch("/spec/volumes", original.Volumes, injected.Volumes)...)
+	return ops
+}
+
+// listPatch returns the operations that replace the changed items and append
+// the added items of a list, which must not have been shortened.
+// The list is added whole if it didn't exist.
+func listPatch[T any](path string, before, after []T) []patchOperation {
+	if len(before) == 0 {
+		if len(after) == 0 {
+			return nil
+		}
+		return []patchOperation{{Op: "add", Path: path, Value: after}}
+	}
+	var ops []patchOperation
+	for i := range after {
+		if i >= len(before) {
+			ops = append(ops, patchOperation{Op: "add", Path: path + "/-", Value: after[i]})
+			continue
+		}
+		if !reflect.DeepEqual(before[i], after[i]) {
+			ops = append(ops, patchOperation{Op: "replace", Path: fmt.Sprintf("%s/%d", path, i), Value: after[i]})
+		}
+	}
+	return ops
+}
@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ShutdownTimeout is how long to wait for in-flight requests when stopping.
+const ShutdownTimeout = 10 * time.Second
+
+// Serve serves the handler over TLS at /mutate, with a /healthz endpoint,
+// until the context is canceled.
+// The certificate and key files are reloaded when they change, so that
+// rotated certificates (ex: by cert-manager) are used without a restart.
+func Serve(ctx context.Context, addr, certFile, keyFile string, handler http.Handler) error {
+	loader := &certLoader{certFile: certFile, keyFile: keyFile}
+	// fail fast on a missing or invalid certificate
+	_, err := loader.GetCertificate(nil)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/mutate", handler)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: loader.GetCertificate,
+		},
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("Webhook: serving on %s\n", addr)
+		errCh <- server.ListenAndServeTLS("", "")
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("failed to serve: %v", err)
+	case <-ctx.Done():
+	}
+
+	log.Println("Webhook: shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		return fmt.Errorf("failed to shut down: %v", err)
+	}
+	err = <-errCh
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %v", err)
+	}
+	return nil
+}
+
+// certLoader loads a TLS key pair, and reloads it when the certificate file
+// modification time changes.
+type certLoader struct {
+	certFile string
+	keyFile  string
+
+	lock    sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (l *certLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	info, err := os.Stat(l.certFile)
+	if err != nil {
+		if l.cert != nil {
+			// keep serving the last good certificate
+			return l.cert, nil
+		}
+		return nil, fmt.Errorf("failed to stat certificate: %v", err)
+	}
+	if l.cert != nil && info.ModTime().Equal(l.modTime) {
+		return l.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		if l.cert != nil {
+			log.Printf("Warning: failed to reload certificate: %v\n", err)
+			return l.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load certificate: %v", err)
+	}
+	if l.cert != nil {
+		log.Println("Webhook: reloaded certificate")
+	}
+	l.cert = &cert
+	l.modTime = info.ModTime()
+	return l.cert, nil
+}
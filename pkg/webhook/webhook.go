@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/karlkfi/kubexit/pkg/inject"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// MaxRequestBytes is the maximum size of an AdmissionReview request body.
+// The API server limits objects to 3MiB, plus the review envelope.
+const MaxRequestBytes = 4 * 1024 * 1024
+
+// Handler returns an http.Handler that serves AdmissionReview v1 requests,
+// injecting kubexit into pods with `kubexit.io/deps.<container>`
+// annotations. Pods without deps annotations are allowed unchanged.
+// Pods with invalid deps are denied, so that misconfiguration is reported
+// when the pod is created, not when it runs. Pods with containers to wrap
+// that don't set a command are allowed unchanged, with a warning, so that
+// pods aren't blocked by an image entrypoint that can't be wrapped.
+func Handler(cfg inject.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		contentType := r.Header.Get("Content-Type")
+		if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+			http.Error(w, fmt.Sprintf("unsupported content type: %s", contentType), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, MaxRequestBytes))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to read request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		review := &admissionv1.AdmissionReview{}
+		err = json.Unmarshal(body, review)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to unmarshal admission review: %v", err), http.StatusBadRequest)
+			return
+		}
+		if review.Request == nil {
+			http.Error(w, "missing admission review request", http.StatusBadRequest)
+			return
+		}
+
+		review.Response = Admit(review.Request, cfg)
+		review.Request = nil
+
+		out, err := json.Marshal(review)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal admission review: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(out)
+		if err != nil {
+			log.Printf("Warning: failed to write admission review: %v\n", err)
+		}
+	})
+}
+
+// Admit returns the admission response for a pod admission request.
+// Requests for other kinds of objects are allowed unchanged.
+func Admit(req *admissionv1.AdmissionRequest, cfg inject.Config) *admissionv1.AdmissionResponse {
+	resp := &admissionv1.AdmissionResponse{
+		UID:     req.UID,
+		Allowed: true,
+	}
+	if req.Kind.Group != "" || req.Kind.Kind != "Pod" || req.Operation != admissionv1.Create {
+		return resp
+	}
+
+	pod := &corev1.Pod{}
+	err := json.Unmarshal(req.Object.Raw, pod)
+	if err != nil {
+		return deny(req.UID, http.StatusBadRequest, fmt.Sprintf("failed to unmarshal pod: %v", err))
+	}
+	// Pods created by controllers may not have a name yet.
+	name := pod.Name
+	if name == "" {
+		name = pod.GenerateName
+	}
+
+	original := pod.Spec.DeepCopy()
+	changed, err := inject.PodSpec(&pod.Spec, pod.Annotations, cfg)
+	if errors.Is(err, inject.ErrNoCommand) {
+		log.Printf("Skipped: pod %s/%s: %v\n", req.Namespace, name, err)
+		resp.Warnings = []string{fmt.Sprintf("kubexit not injected: %v", err)}
+		return resp
+	}
+	if err != nil {
+		log.Printf("Denied: pod %s/%s: %v\n", req.Namespace, name, err)
+		return deny(req.UID, http.StatusUnprocessableEntity, fmt.Sprintf("kubexit injection failed: %v", err))
+	}
+	if !changed {
+		return resp
+	}
+
+	patch, err := json.Marshal(specPatch(original, &pod.Spec))
+	if err != nil {
+		return deny(req.UID, http.StatusInternalServerError, fmt.Sprintf("failed to marshal patch: %v", err))
+	}
+	log.Printf("Injected: pod %s/%s\n", req.Namespace, name)
+
+	patchType := admissionv1.PatchTypeJSONPatch
+	resp.Patch = patch
+	resp.PatchType = &patchType
+	return resp
+}
+
+func deny(uid types.UID, code int32, message string) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		UID:     uid,
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    code,
+			Message: message,
+		},
+	}
+}
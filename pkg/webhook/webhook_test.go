@@ -0,0 +1,236 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/karlkfi/kubexit/pkg/inject"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var update = flag.Bool("update", false, "update the golden response files in testdata")
+
+// TestHandler posts each testdata/<case>.request.json AdmissionReview to the
+// webhook, and compares the response to testdata/<case>.response.json.
+// The base64 encoded patch is decoded, so that the golden files are
+// readable.
+func TestHandler(t *testing.T) {
+	server := httptest.NewServer(Handler(inject.Config{}))
+	defer server.Close()
+
+	requests, err := filepath.Glob(filepath.Join("testdata", "*.request.json"))
+	if err != nil {
+		t.Fatalf("failed to list testdata: %v", err)
+	}
+	if len(requests) == 0 {
+		t.Fatal("no testdata requests found")
+	}
+	for _, requestPath := range requests {
+		name := filepath.Base(requestPath[:len(requestPath)-len(".request.json")])
+		t.Run(name, func(t *testing.T) {
+			request, err := os.ReadFile(requestPath)
+			if err != nil {
+				t.Fatalf("failed to read request: %v", err)
+			}
+			body := post(t, server.URL, "application/json", request, http.StatusOK)
+			actual := decodeResponse(t, body)
+
+			responsePath := filepath.Join("testdata", name+".response.json")
+			if *update {
+				out, err := json.MarshalIndent(actual, "", "  ")
+				if err != nil {
+					t.Fatalf("failed to marshal response: %v", err)
+				}
+				err = os.WriteFile(responsePath, append(out, '\n'), 0644)
+				if err != nil {
+					t.Fatalf("failed to write response: %v", err)
+				}
+				return
+			}
+
+			golden, err := os.ReadFile(responsePath)
+			if err != nil {
+				t.Fatalf("failed to read golden response: %v", err)
+			}
+			var expected interface{}
+			err = json.Unmarshal(golden, &expected)
+			if err != nil {
+				t.Fatalf("failed to unmarshal golden response: %v", err)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				out, _ := json.MarshalIndent(actual, "", "  ")
+				t.Errorf("response does not match %s (run with -update to regenerate):\n%s", responsePath, out)
+			}
+		})
+	}
+}
+
+func TestHandlerContentType(t *testing.T) {
+	server := httptest.NewServer(Handler(inject.Config{}))
+	defer server.Close()
+
+	request, err := os.ReadFile(filepath.Join("testdata", "patched.request.json"))
+	if err != nil {
+		t.Fatalf("failed to read request: %v", err)
+	}
+
+	body := post(t, server.URL, "application/json; charset=utf-8", request, http.StatusOK)
+	response := decodeResponse(t, body).(map[string]interface{})["response"].(map[string]interface{})
+	if response["allowed"] != true || response["patch"] == nil {
+		t.Errorf("expected patched response, got: %v", response)
+	}
+
+	post(t, server.URL, "text/plain", request, http.StatusUnsupportedMediaType)
+	post(t, server.URL, "", request, http.StatusUnsupportedMediaType)
+}
+
+// TestAdmitPreservesUnknownFields applies the patch to the raw pod, to check
+// that fields the typed PodSpec doesn't know about are preserved, and that
+// the patched pod matches the injected pod spec.
+func TestAdmitPreservesUnknownFields(t *testing.T) {
+	request, err := os.ReadFile(filepath.Join("testdata", "unknown-fields.request.json"))
+	if err != nil {
+		t.Fatalf("failed to read request: %v", err)
+	}
+	review := &admissionv1.AdmissionReview{}
+	err = json.Unmarshal(request, review)
+	if err != nil {
+		t.Fatalf("failed to unmarshal request: %v", err)
+	}
+
+	resp := Admit(review.Request, inject.Config{})
+	if !resp.Allowed || resp.Patch == nil {
+		t.Fatalf("expected patched response, got: %+v", resp)
+	}
+	patch, err := jsonpatch.DecodePatch(resp.Patch)
+	if err != nil {
+		t.Fatalf("failed to decode patch: %v", err)
+	}
+	patched, err := patch.Apply(review.Request.Object.Raw)
+	if err != nil {
+		t.Fatalf("failed to apply patch: %v", err)
+	}
+
+	var raw struct {
+		Spec struct {
+			FuturePodField map[string]interface{} `json:"futurePodField"`
+			Containers     []struct {
+				FutureContainerField string `json:"futureContainerField"`
+			} `json:"containers"`
+		} `json:"spec"`
+	}
+	err = json.Unmarshal(patched, &raw)
+	if err != nil {
+		t.Fatalf("failed to unmarshal patched pod: %v", err)
+	}
+	if raw.Spec.FuturePodField["enabled"] != true {
+		t.Errorf("expected pod spec unknown field to be preserved: %s", patched)
+	}
+	for _, i := range []int{0, 2} {
+		if raw.Spec.Containers[i].FutureContainerField != "keep" {
+			t.Errorf("expected container %d unknown field to be preserved: %s", i, patched)
+		}
+	}
+
+	actual := &corev1.Pod{}
+	err = json.Unmarshal(patched, actual)
+	if err != nil {
+		t.Fatalf("failed to unmarshal patched pod: %v", err)
+	}
+	expected := &corev1.Pod{}
+	err = json.Unmarshal(review.Request.Object.Raw, expected)
+	if err != nil {
+		t.Fatalf("failed to unmarshal pod: %v", err)
+	}
+	_, err = inject.PodSpec(&expected.Spec, expected.Annotations, inject.Config{})
+	if err != nil {
+		t.Fatalf("failed to inject pod: %v", err)
+	}
+	if !reflect.DeepEqual(actual.Spec, expected.Spec) {
+		t.Errorf("expected patched spec:\n%+v\ngot:\n%+v", expected.Spec, actual.Spec)
+	}
+}
+
+func TestHandlerBadRequest(t *testing.T) {
+	server := httptest.NewServer(Handler(inject.Config{}))
+	defer server.Close()
+
+	post(t, server.URL, "application/json", []byte("not json"), http.StatusBadRequest)
+	post(t, server.URL, "application/json", []byte(`{"kind":"AdmissionReview"}`), http.StatusBadRequest)
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
+
+// post posts the body and returns the response body, failing the test
+// unless the response has the expected status code.
+func post(t *testing.T, url, contentType string, body []byte, expectedCode int) []byte {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to post: %v", err)
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if resp.StatusCode != expectedCode {
+		t.Fatalf("content type %q: expected status %d, got %d: %s", contentType, expectedCode, resp.StatusCode, out)
+	}
+	return out
+}
+
+// decodeResponse unmarshals an AdmissionReview response, replacing the
+// base64 encoded patch with the decoded JSON Patch.
+func decodeResponse(t *testing.T, body []byte) interface{} {
+	t.Helper()
+	var review map[string]interface{}
+	err := json.Unmarshal(body, &review)
+	if err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	response, ok := review["response"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("missing response: %s", body)
+	}
+	if encoded, ok := response["patch"].(string); ok {
+		// []byte fields are base64 encoded in JSON
+		var patch []byte
+		err = json.Unmarshal([]byte(`"`+encoded+`"`), &patch)
+		if err != nil {
+			t.Fatalf("failed to decode patch: %v", err)
+		}
+		var decoded interface{}
+		err = json.Unmarshal(patch, &decoded)
+		if err != nil {
+			t.Fatalf("failed to unmarshal patch: %v", err)
+		}
+		response["patch"] = decoded
+	}
+	return review
+}
@@ -5,6 +5,8 @@ set -o errexit -o nounset -o pipefail -o posix
 REPO_ROOT="$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd -P)"
 cd "${REPO_ROOT}"
 
+VERSION="${VERSION:-$(git describe --tags --always --dirty 2>/dev/null || echo dev)}"
+
 CGO_ENABLED=0
 export CGO_ENABLED
 
@@ -23,6 +25,6 @@ for PLATFORM in ${PLATFORMS[@]} ; do
   for CMD_DIR in cmd/*/ ; do
     CMD="$(basename "${CMD_DIR}")"
     echo "Building: bin/${PLATFORM}/${CMD}"
-    go build -mod=vendor -o "bin/${PLATFORM}/${CMD}" "./cmd/${CMD}"
+    go build -mod=vendor -ldflags "-X main.version=${VERSION}" -o "bin/${PLATFORM}/${CMD}" "./cmd/${CMD}"
   done
 done